@@ -9,6 +9,72 @@
 //     namespace: <namespace>
 //   spec:
 //     url: https://example.com
+//     interval: 5m
+//     timeout: 10s
+//     method: POST
+//     headers:
+//       - name: Accept
+//         value: application/json
+//       - name: X-API-Key
+//         valueFrom:
+//           secretKeyRef:
+//             name: <secret>
+//             key: <key>
+//     body: '{ "ping": true }'
+//     statusCodes: 200-299,401
+//     content:
+//       contains: [ "ok" ]
+//       notContains: [ "Maintenance mode" ]
+//       matches: [ "version: \\d+" ]
+//       maxSize: 4096
+//     json:
+//       - path: status
+//         operator: eq
+//         value: ok
+//     dns:
+//       addresses: [ 192.0.2.1 ]
+//       cname: example.com
+//       minTTL: 5m
+//     grpc:
+//       service: grpc.health.v1.Health
+//     tcp:
+//       send: "PING\r\n"
+//       expect: "^\\+PONG"
+//     websocket:
+//       send: ping
+//       expect: pong
+//     tls:
+//       deferVerification: true
+//       ca:
+//         file: ca.pem
+//       certificate:
+//         secretKeyRef:
+//           name: <secret>
+//           key: tls.crt
+//       key:
+//         secretKeyRef:
+//           name: <secret>
+//           key: tls.key
+//       minVersion: "1.2"
+//       forbiddenCiphers: [ TLS_RSA_WITH_AES_128_CBC_SHA ]
+//       fingerprints: [ <sha256 fingerprint> ]
+//       issuerCN: R3
+//       checkRevocation: true
+//     proxy:
+//       url: http://proxy.example.com:3128
+//       username: webmon
+//       password:
+//         secretKeyRef:
+//           name: <secret>
+//           key: password
+//     resolveTo: 192.0.2.10
+//     allAddresses: true
+//     quorum: 2
+//     ipFamily: both
+//     retries: 2
+//     retryBackoff: 1s
+//     failureThreshold: 3
+//     successThreshold: 2
 package v1
 
 import (
@@ -23,6 +89,168 @@ type TargetSpec struct {
 	URL string `json:"url"`
 	// Name of the site to monitor. Applied to Prometheus metrics
 	Name string `json:"name"`
+	// Interval specifies how often the site is checked. If not set, the global interval is used
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Timeout specifies how long a check may take
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// Method is the HTTP method used to check the site. Default: GET
+	Method string `json:"method,omitempty"`
+	// Headers lists the HTTP headers added to the request
+	Headers []Header `json:"headers,omitempty"`
+	// Body is sent as the request body
+	Body string `json:"body,omitempty"`
+	// StatusCodes lists the HTTP status codes & ranges that indicate the site is up, e.g. "200-299,401"
+	StatusCodes string `json:"statusCodes,omitempty"`
+	// Content specifies the assertions on the site's response body
+	Content *ContentSpec `json:"content,omitempty"`
+	// JSON lists the assertions on the site's JSON response body
+	JSON []JSONAssertion `json:"json,omitempty"`
+	// DNS contains the assertions on the answer of a dns:// site
+	DNS *DNSSpec `json:"dns,omitempty"`
+	// GRPC specifies how a grpc:// or grpcs:// site is checked
+	GRPC *GRPCSpec `json:"grpc,omitempty"`
+	// TCP specifies how a tcp:// site is checked
+	TCP *TCPSpec `json:"tcp,omitempty"`
+	// WebSocket specifies how a ws:// or wss:// site is checked
+	WebSocket *WebSocketSpec `json:"websocket,omitempty"`
+	// TLS specifies how the site's TLS connection is set up and checked
+	TLS *TLSSpec `json:"tls,omitempty"`
+	// Proxy specifies the proxy used to connect to the site
+	Proxy *ProxySpec `json:"proxy,omitempty"`
+	// ResolveTo is the IP address used to connect to the site, instead of the addresses of its hostname in DNS
+	ResolveTo string `json:"resolveTo,omitempty"`
+	// AllAddresses checks the site at each IP address of its hostname
+	AllAddresses bool `json:"allAddresses,omitempty"`
+	// Quorum is the number of addresses that must be up for the site to be up. Default: all addresses
+	Quorum int `json:"quorum,omitempty"`
+	// IPFamily forces the IP family used to connect to the site: v4 or v6. Use both to check the site over both families
+	IPFamily string `json:"ipFamily,omitempty"`
+	// Retries is the number of times a failed check is retried
+	Retries int `json:"retries,omitempty"`
+	// RetryBackoff is the time to wait before the first retry. It doubles after each retry
+	RetryBackoff *metav1.Duration `json:"retryBackoff,omitempty"`
+	// FailureThreshold is the number of consecutive failed checks before the site is reported as down. Default: 1
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+	// SuccessThreshold is the number of consecutive successful checks before the site is reported as up. Default: 1
+	SuccessThreshold int `json:"successThreshold,omitempty"`
+}
+
+// Header is added to the HTTP request when checking the site
+type Header struct {
+	// Name of the header. Use "Host" to override the request's virtual host
+	Name string `json:"name"`
+	// Value of the header
+	Value string `json:"value,omitempty"`
+	// ValueFrom reads the header's value from a file or a Secret. Takes precedence over Value
+	ValueFrom *ValueSource `json:"valueFrom,omitempty"`
+}
+
+// ValueSource specifies where to read a (secret) value from
+type ValueSource struct {
+	// File contains the name of the file holding the value. The file must be in the directory that webmon allows
+	// Targets to read files from (its --watch.files argument). Relative names are relative to that directory
+	File string `json:"file,omitempty"`
+	// SecretKeyRef selects a key of a Secret in the Target's namespace
+	SecretKeyRef *SecretKeySelector `json:"secretKeyRef,omitempty"`
+}
+
+// SecretKeySelector selects a key of a Secret
+type SecretKeySelector struct {
+	// Name of the Secret
+	Name string `json:"name"`
+	// Key of the Secret's data to select
+	Key string `json:"key"`
+}
+
+// ContentSpec contains the assertions that the site's response body must meet
+type ContentSpec struct {
+	// Contains lists the strings that the response body must contain
+	Contains []string `json:"contains,omitempty"`
+	// NotContains lists the strings that the response body may not contain
+	NotContains []string `json:"notContains,omitempty"`
+	// Matches lists the regular expressions that the response body must match
+	Matches []string `json:"matches,omitempty"`
+	// MaxSize is the maximum number of bytes that are read from the response body
+	MaxSize int64 `json:"maxSize,omitempty"`
+}
+
+// JSONAssertion checks a value in the site's JSON response body
+type JSONAssertion struct {
+	// Path of the value in the JSON document, in dot notation, e.g. "checks.0.status"
+	Path string `json:"path"`
+	// Operator used to compare the value: eq, ne, lt, le, gt, ge, contains, matches, exists or not_exists. Default: eq
+	Operator string `json:"operator,omitempty"`
+	// Value to compare against
+	Value string `json:"value,omitempty"`
+}
+
+// DNSSpec contains the assertions on the answer of a dns:// site
+type DNSSpec struct {
+	// Addresses lists the IP addresses that the answer must contain
+	Addresses []string `json:"addresses,omitempty"`
+	// CNAME is the canonical name that the name must resolve to
+	CNAME string `json:"cname,omitempty"`
+	// MinTTL is the minimum TTL of the records in the answer
+	MinTTL *metav1.Duration `json:"minTTL,omitempty"`
+	// NXDomain expects the name not to exist
+	NXDomain bool `json:"nxdomain,omitempty"`
+}
+
+// GRPCSpec specifies how a grpc:// or grpcs:// site is checked
+type GRPCSpec struct {
+	// Service is the name of the service whose health is checked. If blank, the server's overall health is checked
+	Service string `json:"service,omitempty"`
+}
+
+// TCPSpec specifies how a tcp:// site is checked
+type TCPSpec struct {
+	// Send is written to the connection once it's set up
+	Send string `json:"send,omitempty"`
+	// Expect is a regular expression that the site's response must match
+	Expect string `json:"expect,omitempty"`
+}
+
+// WebSocketSpec specifies how a ws:// or wss:// site is checked
+type WebSocketSpec struct {
+	// Send is sent as a text message once the WebSocket handshake completes
+	Send string `json:"send,omitempty"`
+	// Expect is a regular expression that the site's reply must match
+	Expect string `json:"expect,omitempty"`
+}
+
+// TLSSpec specifies how the site's TLS connection is set up and checked
+type TLSSpec struct {
+	// DeferVerification performs the TLS handshake without verifying the site's certificate. The certificate is
+	// verified afterwards and the result is reported separately
+	DeferVerification bool `json:"deferVerification,omitempty"`
+	// CA reads the PEM-encoded CA certificates used to verify the site's certificate from a file or a Secret
+	CA *ValueSource `json:"ca,omitempty"`
+	// Certificate reads the PEM-encoded client certificate used for mutual TLS from a file or a Secret
+	Certificate *ValueSource `json:"certificate,omitempty"`
+	// Key reads the PEM-encoded client key used for mutual TLS from a file or a Secret
+	Key *ValueSource `json:"key,omitempty"`
+	// MinVersion is the minimum TLS version that the site must negotiate: 1.0, 1.1, 1.2 or 1.3
+	MinVersion string `json:"minVersion,omitempty"`
+	// ForbiddenCiphers lists the cipher suites that the site may not negotiate
+	ForbiddenCiphers []string `json:"forbiddenCiphers,omitempty"`
+	// Fingerprints pins the site's certificate to one of these SHA-256 fingerprints
+	Fingerprints []string `json:"fingerprints,omitempty"`
+	// IssuerCN pins the common name of the issuer of the site's certificate
+	IssuerCN string `json:"issuerCN,omitempty"`
+	// CheckRevocation checks if the site's certificate has been revoked, using OCSP or CRLs
+	CheckRevocation bool `json:"checkRevocation,omitempty"`
+}
+
+// ProxySpec specifies the proxy used to connect to the site
+type ProxySpec struct {
+	// URL of the proxy: http://, https:// (HTTP CONNECT) or socks5://
+	URL string `json:"url,omitempty"`
+	// Direct connects to the site without a proxy, even if a proxy is configured in the environment
+	Direct bool `json:"direct,omitempty"`
+	// Username used to authenticate with the proxy
+	Username string `json:"username,omitempty"`
+	// Password reads the password used to authenticate with the proxy from a file or a Secret
+	Password *ValueSource `json:"password,omitempty"`
 }
 
 // Target layout for the custom resource
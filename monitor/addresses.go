@@ -0,0 +1,151 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/sync/semaphore"
+	"net"
+	"sort"
+	"sync"
+)
+
+// AddressState contains the result of checking one of a site's IP addresses. See SiteSpec.AllAddresses
+type AddressState struct {
+	// Address is the IP address that was checked
+	Address string `json:"address"`
+	// Up indicates if the site was up at this address
+	Up bool `json:"up"`
+	// LastError contains the reason why the site was down at this address
+	LastError string `json:"last_error,omitempty"`
+	// Latency contains the time it took to check the site at this address
+	Latency Duration `json:"latency"`
+}
+
+// pinnedAddress is the IP address used to connect to a host, instead of resolving the host's name
+type pinnedAddress struct {
+	host string
+	ip   string
+}
+
+type pinnedAddressKey struct{}
+
+// withPinnedAddress returns a context that pins connections to host to the specified IP address
+func withPinnedAddress(ctx context.Context, host, ip string) context.Context {
+	return context.WithValue(ctx, pinnedAddressKey{}, pinnedAddress{host: host, ip: ip})
+}
+
+// dialAddress returns the address to connect to. If the context pins the address's host to an IP address, the host
+// is replaced by that IP address. Other hosts (e.g. a proxy) are left as is.
+func dialAddress(ctx context.Context, address string) string {
+	pinned, ok := ctx.Value(pinnedAddressKey{}).(pinnedAddress)
+	if ok == false {
+		return address
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || host != pinned.host {
+		return address
+	}
+	return net.JoinHostPort(pinned.ip, port)
+}
+
+// checkHost checks the site at each of its hostname's IP addresses if the site's AllAddresses is set. Otherwise, it
+// checks the site at the address picked by the dialer.
+func (monitor *Monitor) checkHost(ctx context.Context, site SiteSpec, hostname string, check checker) *SiteState {
+	if site.AllAddresses {
+		return monitor.checkAddresses(ctx, site, hostname, check)
+	}
+	return check(monitor, ctx, site)
+}
+
+// lookup returns the IP addresses of the site's hostname, sorted. If the site's ResolveTo is set, that is the
+// hostname's only address.
+func (monitor *Monitor) lookup(ctx context.Context, site SiteSpec, hostname string) (ips []string, err error) {
+	if site.ResolveTo != "" {
+		return []string{site.ResolveTo}, nil
+	}
+	resolver := monitor.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addresses, err := resolver.LookupIP(ctx, lookupNetwork(ctx), hostname)
+	if err != nil {
+		return nil, err
+	}
+	for _, address := range addresses {
+		ips = append(ips, address.String())
+	}
+	sort.Strings(ips)
+	return ips, nil
+}
+
+// checkAddresses resolves the site's hostname and checks the site at each of its IP addresses, using the original
+// hostname for the Host header and TLS SNI. At most MaxConcurrentChecks addresses are checked in parallel. The site is
+// up if at least the site's Quorum of addresses are up: if the hostname has fewer addresses than the Quorum, the site is
+// down.
+// The site's state is the state of the first address that is up (or the first address if none are up), with the
+// result of each address reported in Addresses.
+func (monitor *Monitor) checkAddresses(ctx context.Context, site SiteSpec, hostname string, check checker) (state *SiteState) {
+	ips, err := monitor.lookup(ctx, site, hostname)
+	if err != nil {
+		return &SiteState{LastError: err.Error()}
+	}
+
+	// check at most MaxConcurrentChecks addresses in parallel
+	states := make([]*SiteState, len(ips))
+	maxJobs := semaphore.NewWeighted(monitor.maxConcurrentChecks())
+	var wg sync.WaitGroup
+	for index, ip := range ips {
+		if err = maxJobs.Acquire(ctx, 1); err != nil {
+			states[index] = &SiteState{LastError: err.Error()}
+			continue
+		}
+		wg.Add(1)
+		go func(index int, ip string) {
+			states[index] = check(monitor, withPinnedAddress(ctx, hostname, ip), site)
+			maxJobs.Release(1)
+			wg.Done()
+		}(index, ip)
+	}
+	wg.Wait()
+
+	var up int
+	results := make([]AddressState, 0, len(ips))
+	for index, addressState := range states {
+		results = append(results, AddressState{
+			Address:   ips[index],
+			Up:        addressState.Up,
+			LastError: addressState.LastError,
+			Latency:   addressState.Latency,
+		})
+		if addressState.Up {
+			if up == 0 {
+				state = addressState
+			}
+			up++
+		}
+	}
+	if state == nil {
+		state = states[0]
+	}
+	state.Addresses = results
+
+	quorum := site.Quorum
+	if quorum <= 0 {
+		quorum = len(ips)
+	}
+	if quorum > len(ips) {
+		state.Up = false
+		state.LastError = fmt.Sprintf("quorum %d exceeds the number of addresses (%d)", quorum, len(ips))
+		return
+	}
+	if state.Up = up >= quorum; state.Up == false {
+		state.LastError = fmt.Sprintf("%d of %d addresses up (quorum: %d)", up, len(ips), quorum)
+		for _, result := range results {
+			if result.Up == false {
+				state.LastError += fmt.Sprintf(". %s: %s", result.Address, result.LastError)
+				break
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,296 @@
+package monitor_test
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/clambin/gotools/metrics"
+	"github.com/clambin/webmon/monitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMonitor_CheckSites_AllAddresses(t *testing.T) {
+	port := newAddressServers(t, nil, "127.0.0.1", "127.0.0.2")
+	dnsServer := newDNSServer(t,
+		aRecord("www.example.com.", "127.0.0.1", 300),
+		aRecord("www.example.com.", "127.0.0.2", 300),
+		aRecord("www.example.com.", "127.0.0.3", 300),
+	)
+	defer dnsServer.close()
+	url := "http://www.example.com:" + port
+
+	testCases := []struct {
+		name      string
+		quorum    int
+		up        bool
+		lastError string
+	}{
+		{name: "all addresses", lastError: "2 of 3 addresses up (quorum: 3). 127.0.0.3: "},
+		{name: "quorum", quorum: 2, up: true},
+		{name: "quorum not met", quorum: 3, lastError: "2 of 3 addresses up (quorum: 3)"},
+		{name: "quorum too large", quorum: 4, lastError: "quorum 4 exceeds the number of addresses (3)"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMonitor(t, monitor.SiteSpec{URL: url, AllAddresses: true, Quorum: tt.quorum, Timeout: monitor.Duration{Duration: time.Second}})
+			m.Resolver = newResolver(dnsServer.address())
+			m.CheckSites(context.Background())
+
+			entry, ok := m.GetEntry(url)
+			require.True(t, ok)
+			require.NotNil(t, entry.State)
+			assert.Equal(t, tt.up, entry.State.Up)
+			assert.Contains(t, entry.State.LastError, tt.lastError)
+			require.Len(t, entry.State.Addresses, 3)
+			for index, address := range []string{"127.0.0.1", "127.0.0.2", "127.0.0.3"} {
+				assert.Equal(t, address, entry.State.Addresses[index].Address)
+				assert.Equal(t, index < 2, entry.State.Addresses[index].Up, address)
+			}
+			assert.Equal(t, http.StatusOK, entry.State.HTTPCode)
+		})
+	}
+}
+
+func TestMonitor_CheckSites_AllAddresses_MaxConcurrentChecks(t *testing.T) {
+	addresses := []string{"127.0.0.1", "127.0.0.2", "127.0.0.3", "127.0.0.4"}
+	var current, peak int32
+	var port string
+	for _, address := range addresses {
+		if port == "" {
+			port = "0"
+		}
+		listener, err := net.Listen("tcp", net.JoinHostPort(address, port))
+		require.NoError(t, err)
+		_, port, _ = net.SplitHostPort(listener.Addr().String())
+		t.Cleanup(func() { _ = listener.Close() })
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					// record how many addresses are being checked in parallel
+					count := atomic.AddInt32(&current, 1)
+					for old := atomic.LoadInt32(&peak); count > old && atomic.CompareAndSwapInt32(&peak, old, count) == false; {
+						old = atomic.LoadInt32(&peak)
+					}
+					time.Sleep(50 * time.Millisecond)
+					atomic.AddInt32(&current, -1)
+					_, _ = conn.Write([]byte("220 ready\r\n"))
+					_ = conn.Close()
+				}()
+			}
+		}()
+	}
+	var records []dnsmessage.Resource
+	for _, address := range addresses {
+		records = append(records, aRecord("mail.example.com.", address, 300))
+	}
+	dnsServer := newDNSServer(t, records...)
+	defer dnsServer.close()
+
+	url := "tcp://mail.example.com:" + port
+	m := newMonitor(t, monitor.SiteSpec{URL: url, AllAddresses: true, TCP: &monitor.TCPSpec{Expect: "220"}, Timeout: monitor.Duration{Duration: time.Second}})
+	m.Resolver = newResolver(dnsServer.address())
+	m.MaxConcurrentChecks = 2
+	m.CheckSites(context.Background())
+
+	entry, ok := m.GetEntry(url)
+	require.True(t, ok)
+	require.NotNil(t, entry.State)
+	assert.True(t, entry.State.Up, entry.State.LastError)
+	assert.Len(t, entry.State.Addresses, len(addresses))
+	assert.LessOrEqual(t, atomic.LoadInt32(&peak), int32(2))
+}
+
+func TestMonitor_CheckSites_AllAddresses_TLS(t *testing.T) {
+	root := newTestCA(t, "root", nil, 10*365*24*time.Hour)
+	certificate := root.issue(t, 30*24*time.Hour, "www.example.com")
+	port := newAddressServers(t, &certificate, "127.0.0.1", "127.0.0.2")
+	dnsServer := newDNSServer(t,
+		aRecord("www.example.com.", "127.0.0.1", 300),
+		aRecord("www.example.com.", "127.0.0.2", 300),
+	)
+	defer dnsServer.close()
+
+	for _, scheme := range []string{"https", "tls"} {
+		t.Run(scheme, func(t *testing.T) {
+			url := scheme + "://www.example.com:" + port
+			m := newMonitor(t, monitor.SiteSpec{URL: url, AllAddresses: true, TLS: &monitor.TLSSpec{CA: root.pem()}, Timeout: monitor.Duration{Duration: time.Second}})
+			m.Resolver = newResolver(dnsServer.address())
+			m.CheckSites(context.Background())
+
+			entry, ok := m.GetEntry(url)
+			require.True(t, ok)
+			require.NotNil(t, entry.State)
+			assert.True(t, entry.State.Up)
+			assert.Empty(t, entry.State.LastError)
+			assert.Equal(t, monitor.TLSVerificationOK, entry.State.TLSVerification)
+			require.Len(t, entry.State.Addresses, 2)
+			for _, address := range entry.State.Addresses {
+				assert.True(t, address.Up, address.Address)
+				assert.NotZero(t, address.Latency.Duration)
+			}
+		})
+	}
+}
+
+func TestMonitor_CheckSites_AllAddresses_Unresolved(t *testing.T) {
+	dnsServer := newDNSServer(t)
+	defer dnsServer.close()
+	url := "tcp://www.example.com:80"
+
+	m := newMonitor(t, monitor.SiteSpec{URL: url, AllAddresses: true, Timeout: monitor.Duration{Duration: time.Second}})
+	m.Resolver = newResolver(dnsServer.address())
+	m.CheckSites(context.Background())
+
+	entry, ok := m.GetEntry(url)
+	require.True(t, ok)
+	require.NotNil(t, entry.State)
+	assert.False(t, entry.State.Up)
+	assert.Contains(t, entry.State.LastError, "no such host")
+	assert.Empty(t, entry.State.Addresses)
+}
+
+func TestMonitor_CheckSites_ResolveTo(t *testing.T) {
+	root := newTestCA(t, "root", nil, 10*365*24*time.Hour)
+	certificate := root.issue(t, 30*24*time.Hour, "www.example.com")
+	port := newAddressServers(t, &certificate, "127.0.0.1")
+
+	testCases := []struct {
+		name         string
+		url          string
+		resolveTo    string
+		tls          *monitor.TLSSpec
+		up           bool
+		lastError    string
+		verification string
+	}{
+		{name: "https", url: "https://www.example.com:" + port, resolveTo: "127.0.0.1", up: true, verification: monitor.TLSVerificationOK},
+		{name: "tls", url: "tls://www.example.com:" + port, resolveTo: "127.0.0.1", up: true, verification: monitor.TLSVerificationOK},
+		{name: "hostname mismatch", url: "https://www.example.net:" + port, resolveTo: "127.0.0.1", lastError: "x509: certificate is valid for www.example.com", verification: monitor.TLSVerificationHostnameMismatch},
+		{name: "deferred", url: "https://www.example.net:" + port, resolveTo: "127.0.0.1", tls: &monitor.TLSSpec{DeferVerification: true}, up: true, verification: monitor.TLSVerificationHostnameMismatch},
+		{name: "unreachable", url: "https://www.example.com:" + port, resolveTo: "127.0.0.2", lastError: "connection refused"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsSpec := tt.tls
+			if tlsSpec == nil {
+				tlsSpec = &monitor.TLSSpec{}
+			}
+			tlsSpec.CA = root.pem()
+			m := newMonitor(t, monitor.SiteSpec{URL: tt.url, ResolveTo: tt.resolveTo, TLS: tlsSpec, Timeout: monitor.Duration{Duration: time.Second}})
+			m.CheckSites(context.Background())
+
+			entry, ok := m.GetEntry(tt.url)
+			require.True(t, ok)
+			require.NotNil(t, entry.State)
+			assert.Equal(t, tt.up, entry.State.Up)
+			assert.Contains(t, entry.State.LastError, tt.lastError)
+			assert.Equal(t, tt.verification, entry.State.TLSVerification)
+		})
+	}
+}
+
+func TestMonitor_CheckSites_ResolveTo_AllAddresses(t *testing.T) {
+	port := newAddressServers(t, nil, "127.0.0.1")
+	url := "http://www.example.com:" + port
+
+	m := newMonitor(t, monitor.SiteSpec{URL: url, ResolveTo: "127.0.0.1", AllAddresses: true, Timeout: monitor.Duration{Duration: time.Second}})
+	m.CheckSites(context.Background())
+
+	entry, ok := m.GetEntry(url)
+	require.True(t, ok)
+	require.NotNil(t, entry.State)
+	assert.True(t, entry.State.Up)
+	assert.Equal(t, http.StatusOK, entry.State.HTTPCode)
+	require.Len(t, entry.State.Addresses, 1)
+	assert.Equal(t, "127.0.0.1", entry.State.Addresses[0].Address)
+}
+
+func TestCollector_Collect_AllAddresses(t *testing.T) {
+	port := newAddressServers(t, nil, "127.0.0.1")
+	dnsServer := newDNSServer(t,
+		aRecord("www.example.com.", "127.0.0.1", 300),
+		aRecord("www.example.com.", "127.0.0.2", 300),
+	)
+	defer dnsServer.close()
+	url := "tcp://www.example.com:" + port
+
+	m := newMonitor(t, monitor.SiteSpec{URL: url, AllAddresses: true, Quorum: 1, Timeout: monitor.Duration{Duration: time.Second}})
+	m.Resolver = newResolver(dnsServer.address())
+	m.CheckSites(context.Background())
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		m.Collect(ch)
+		close(ch)
+	}()
+
+	up := make(map[string]float64)
+	latency := make(map[string]float64)
+	for metric := range ch {
+		switch metrics.MetricName(metric) {
+		case "webmon_site_up":
+			assert.Equal(t, 1.0, metrics.MetricValue(metric).GetGauge().GetValue())
+		case "webmon_site_address_up":
+			up[metrics.MetricLabel(metric, "address")] = metrics.MetricValue(metric).GetGauge().GetValue()
+		case "webmon_site_address_latency_seconds":
+			latency[metrics.MetricLabel(metric, "address")] = metrics.MetricValue(metric).GetGauge().GetValue()
+		}
+	}
+	assert.Equal(t, map[string]float64{"127.0.0.1": 1.0, "127.0.0.2": 0.0}, up)
+	require.Contains(t, latency, "127.0.0.1")
+	assert.NotContains(t, latency, "127.0.0.2")
+}
+
+// newAddressServers starts an HTTP server on the same port at each of the addresses and returns the port. If
+// certificate is set, the servers use TLS.
+func newAddressServers(t *testing.T, certificate *tls.Certificate, addresses ...string) string {
+	t.Helper()
+	var port string
+	for _, address := range addresses {
+		if port == "" {
+			port = "0"
+		}
+		listener, err := net.Listen("tcp", net.JoinHostPort(address, port))
+		require.NoError(t, err)
+		_, port, _ = net.SplitHostPort(listener.Addr().String())
+
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		_ = server.Listener.Close()
+		server.Listener = listener
+		if certificate != nil {
+			server.TLS = &tls.Config{Certificates: []tls.Certificate{*certificate}}
+			server.StartTLS()
+		} else {
+			server.Start()
+		}
+		t.Cleanup(server.Close)
+	}
+	return port
+}
+
+// newResolver returns a resolver that sends all queries to the DNS server at the specified address
+func newResolver(address string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, address)
+		},
+	}
+}
@@ -0,0 +1,239 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Supported JSONAssertion operators
+const (
+	OperatorEqual              = "eq"
+	OperatorNotEqual           = "ne"
+	OperatorLessThan           = "lt"
+	OperatorLessThanOrEqual    = "le"
+	OperatorGreaterThan        = "gt"
+	OperatorGreaterThanOrEqual = "ge"
+	OperatorContains           = "contains"
+	OperatorMatches            = "matches"
+	OperatorExists             = "exists"
+	OperatorNotExists          = "not_exists"
+)
+
+// A JSONAssertion checks a value in a site's JSON response body.
+type JSONAssertion struct {
+	// Path of the value in the JSON document, in dot notation, e.g. "status" or "checks.0.status".
+	// Use "#" to get the length of an array (e.g. "checks.#") and "\." to escape a dot in a key name.
+	Path string `json:"path"`
+	// Operator used to compare the value. Default: OperatorEqual
+	Operator string `json:"operator,omitempty"`
+	// Value to compare against. Not used for OperatorExists and OperatorNotExists
+	Value string `json:"value,omitempty"`
+}
+
+// String returns a description of the assertion. This is used as the assertion's label in Prometheus metrics
+func (assertion JSONAssertion) String() string {
+	operator := assertion.operator()
+	if operator == OperatorExists || operator == OperatorNotExists {
+		return assertion.Path + " " + operator
+	}
+	return assertion.Path + " " + operator + " " + assertion.Value
+}
+
+func (assertion JSONAssertion) operator() string {
+	if assertion.Operator == "" {
+		return OperatorEqual
+	}
+	return assertion.Operator
+}
+
+func (assertion JSONAssertion) validate() (err error) {
+	switch operator := assertion.operator(); operator {
+	case OperatorEqual, OperatorNotEqual, OperatorContains, OperatorExists, OperatorNotExists:
+	case OperatorLessThan, OperatorLessThanOrEqual, OperatorGreaterThan, OperatorGreaterThanOrEqual:
+		if _, err = strconv.ParseFloat(assertion.Value, 64); err != nil {
+			err = fmt.Errorf("\"%s\" is not a number", assertion.Value)
+		}
+	case OperatorMatches:
+		if _, err = regexp.Compile(assertion.Value); err != nil {
+			err = fmt.Errorf("invalid regular expression: %w", err)
+		}
+	default:
+		err = fmt.Errorf("unknown operator \"%s\"", operator)
+	}
+	return
+}
+
+// checkJSON decodes the content and checks each assertion. It returns the result of each assertion (keyed by the
+// assertion's description) and an error describing the first failed assertion. If the content isn't valid JSON,
+// each assertion fails.
+func checkJSON(assertions []JSONAssertion, content []byte) (results map[string]bool, err error) {
+	var document interface{}
+	if err = json.Unmarshal(content, &document); err != nil {
+		return failedAssertions(assertions), fmt.Errorf("response body is not valid JSON: %w", err)
+	}
+
+	results = make(map[string]bool)
+	for _, assertion := range assertions {
+		checkErr := assertion.check(document)
+		results[assertion.String()] = checkErr == nil
+		if checkErr != nil && err == nil {
+			err = fmt.Errorf("assertion \"%s\" failed: %w", assertion, checkErr)
+		}
+	}
+	return
+}
+
+// failedAssertions reports each assertion as failed. This is used when the response body couldn't be checked
+func failedAssertions(assertions []JSONAssertion) map[string]bool {
+	results := make(map[string]bool)
+	for _, assertion := range assertions {
+		results[assertion.String()] = false
+	}
+	return results
+}
+
+func (assertion JSONAssertion) check(document interface{}) error {
+	value, found := lookupJSON(document, assertion.Path)
+
+	switch assertion.operator() {
+	case OperatorExists:
+		if found == false {
+			return fmt.Errorf("not found")
+		}
+		return nil
+	case OperatorNotExists:
+		if found {
+			return fmt.Errorf("found %s", jsonValueString(value))
+		}
+		return nil
+	}
+
+	if found == false {
+		return fmt.Errorf("not found")
+	}
+
+	ok, err := assertion.compare(value)
+	if err == nil && ok == false {
+		err = fmt.Errorf("got %s", jsonValueString(value))
+	}
+	return err
+}
+
+func (assertion JSONAssertion) compare(value interface{}) (bool, error) {
+	switch operator := assertion.operator(); operator {
+	case OperatorEqual:
+		return jsonValueEqual(value, assertion.Value), nil
+	case OperatorNotEqual:
+		return jsonValueEqual(value, assertion.Value) == false, nil
+	case OperatorLessThan, OperatorLessThanOrEqual, OperatorGreaterThan, OperatorGreaterThanOrEqual:
+		return compareNumbers(operator, value, assertion.Value)
+	case OperatorContains:
+		if list, ok := value.([]interface{}); ok {
+			for _, item := range list {
+				if jsonValueEqual(item, assertion.Value) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+		return strings.Contains(jsonValueString(value), assertion.Value), nil
+	case OperatorMatches:
+		re, err := regexp.Compile(assertion.Value)
+		if err != nil {
+			return false, fmt.Errorf("invalid regular expression: %w", err)
+		}
+		return re.MatchString(jsonValueString(value)), nil
+	default:
+		return false, fmt.Errorf("unknown operator \"%s\"", operator)
+	}
+}
+
+func compareNumbers(operator string, value interface{}, expected string) (bool, error) {
+	number, ok := value.(float64)
+	if ok == false {
+		return false, fmt.Errorf("%s is not a number", jsonValueString(value))
+	}
+	limit, err := strconv.ParseFloat(expected, 64)
+	if err != nil {
+		return false, fmt.Errorf("\"%s\" is not a number", expected)
+	}
+
+	switch operator {
+	case OperatorLessThan:
+		return number < limit, nil
+	case OperatorLessThanOrEqual:
+		return number <= limit, nil
+	case OperatorGreaterThan:
+		return number > limit, nil
+	default:
+		return number >= limit, nil
+	}
+}
+
+// lookupJSON returns the value at the specified path in a decoded JSON document
+func lookupJSON(document interface{}, path string) (value interface{}, found bool) {
+	value = document
+	for _, key := range splitJSONPath(path) {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			value, found = node[key]
+		case []interface{}:
+			if key == "#" {
+				value, found = float64(len(node)), true
+				break
+			}
+			index, err := strconv.Atoi(key)
+			found = err == nil && index >= 0 && index < len(node)
+			if found {
+				value = node[index]
+			}
+		default:
+			found = false
+		}
+		if found == false {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func splitJSONPath(path string) (keys []string) {
+	var key strings.Builder
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '\\' && i+1 < len(path) && path[i+1] == '.':
+			key.WriteByte('.')
+			i++
+		case path[i] == '.':
+			keys = append(keys, key.String())
+			key.Reset()
+		default:
+			key.WriteByte(path[i])
+		}
+	}
+	return append(keys, key.String())
+}
+
+func jsonValueEqual(value interface{}, expected string) bool {
+	if number, ok := value.(float64); ok {
+		if expectedNumber, err := strconv.ParseFloat(expected, 64); err == nil {
+			return number == expectedNumber
+		}
+	}
+	return jsonValueString(value) == expected
+}
+
+func jsonValueString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		out, _ := json.Marshal(v)
+		return string(out)
+	}
+}
@@ -0,0 +1,141 @@
+package monitor_test
+
+import (
+	"context"
+	"github.com/clambin/gotools/metrics"
+	"github.com/clambin/webmon/monitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const jsonBody = `{
+  "status": "ok",
+  "db": "down",
+  "uptime": 3600,
+  "checks": [ { "name": "cache", "status": "ok" }, { "name": "queue", "status": "ok" } ],
+  "tags": [ "prod", "eu" ],
+  "version.major": 2
+}`
+
+func TestMonitor_CheckSites_JSON(t *testing.T) {
+	stub := &serverStub{}
+	stub.Body(jsonBody)
+	testServer := httptest.NewServer(http.HandlerFunc(stub.Handle))
+	defer testServer.Close()
+
+	testCases := []struct {
+		name      string
+		assertion monitor.JSONAssertion
+		pass      bool
+		lastError string
+	}{
+		{name: "default operator", assertion: monitor.JSONAssertion{Path: "status", Value: "ok"}, pass: true},
+		{name: "eq - fail", assertion: monitor.JSONAssertion{Path: "db", Operator: "eq", Value: "up"}, lastError: `assertion "db eq up" failed: got down`},
+		{name: "ne", assertion: monitor.JSONAssertion{Path: "db", Operator: "ne", Value: "up"}, pass: true},
+		{name: "number", assertion: monitor.JSONAssertion{Path: "uptime", Value: "3600.0"}, pass: true},
+		{name: "gt", assertion: monitor.JSONAssertion{Path: "uptime", Operator: "gt", Value: "60"}, pass: true},
+		{name: "lt - fail", assertion: monitor.JSONAssertion{Path: "uptime", Operator: "lt", Value: "60"}, lastError: `assertion "uptime lt 60" failed: got 3600`},
+		{name: "le - not a number", assertion: monitor.JSONAssertion{Path: "status", Operator: "le", Value: "60"}, lastError: `assertion "status le 60" failed: ok is not a number`},
+		{name: "array index", assertion: monitor.JSONAssertion{Path: "checks.1.name", Value: "queue"}, pass: true},
+		{name: "array length", assertion: monitor.JSONAssertion{Path: "checks.#", Operator: "ge", Value: "2"}, pass: true},
+		{name: "array contains", assertion: monitor.JSONAssertion{Path: "tags", Operator: "contains", Value: "eu"}, pass: true},
+		{name: "string contains", assertion: monitor.JSONAssertion{Path: "status", Operator: "contains", Value: "k"}, pass: true},
+		{name: "matches", assertion: monitor.JSONAssertion{Path: "checks.0.status", Operator: "matches", Value: "^(ok|degraded)$"}, pass: true},
+		{name: "escaped key", assertion: monitor.JSONAssertion{Path: `version\.major`, Value: "2"}, pass: true},
+		{name: "exists", assertion: monitor.JSONAssertion{Path: "db", Operator: "exists"}, pass: true},
+		{name: "exists - fail", assertion: monitor.JSONAssertion{Path: "checks.5", Operator: "exists"}, lastError: `assertion "checks.5 exists" failed: not found`},
+		{name: "not_exists", assertion: monitor.JSONAssertion{Path: "error", Operator: "not_exists"}, pass: true},
+		{name: "not found", assertion: monitor.JSONAssertion{Path: "status.code", Value: "200"}, lastError: `assertion "status.code eq 200" failed: not found`},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			m := newMonitor(t, monitor.SiteSpec{URL: testServer.URL, JSON: []monitor.JSONAssertion{tt.assertion}})
+
+			m.CheckSites(ctx)
+
+			entry, ok := m.GetEntry(testServer.URL)
+			require.True(t, ok)
+			require.NotNil(t, entry.State)
+			assert.Equal(t, tt.pass, entry.State.Up)
+			assert.Equal(t, tt.lastError, entry.State.LastError)
+			assert.Equal(t, map[string]bool{tt.assertion.String(): tt.pass}, entry.State.Assertions)
+		})
+	}
+}
+
+func TestMonitor_CheckSites_JSON_Invalid(t *testing.T) {
+	stub := &serverStub{}
+	stub.Body("Maintenance mode")
+	testServer := httptest.NewServer(http.HandlerFunc(stub.Handle))
+	defer testServer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := newMonitor(t, monitor.SiteSpec{URL: testServer.URL, JSON: []monitor.JSONAssertion{{Path: "status", Value: "ok"}}})
+
+	m.CheckSites(ctx)
+
+	entry, ok := m.GetEntry(testServer.URL)
+	require.True(t, ok)
+	require.NotNil(t, entry.State)
+	assert.False(t, entry.State.Up)
+	assert.Equal(t, "response body is not valid JSON: invalid character 'M' looking for beginning of value", entry.State.LastError)
+	assert.Equal(t, map[string]bool{"status eq ok": false}, entry.State.Assertions)
+}
+
+func TestMonitor_CheckSites_JSON_NotChecked(t *testing.T) {
+	stub := &serverStub{}
+	stub.Body(jsonBody)
+	stub.StatusCode(http.StatusServiceUnavailable)
+	testServer := httptest.NewServer(http.HandlerFunc(stub.Handle))
+	defer testServer.Close()
+
+	m := newMonitor(t, monitor.SiteSpec{URL: testServer.URL, JSON: []monitor.JSONAssertion{
+		{Path: "status", Value: "ok"},
+		{Path: "db", Value: "up"},
+	}})
+	m.CheckSites(context.Background())
+
+	entry, ok := m.GetEntry(testServer.URL)
+	require.True(t, ok)
+	require.NotNil(t, entry.State)
+	assert.False(t, entry.State.Up)
+	assert.Equal(t, map[string]bool{"status eq ok": false, "db eq up": false}, entry.State.Assertions)
+}
+
+func TestCollector_Collect_Assertions(t *testing.T) {
+	stub := &serverStub{}
+	stub.Body(jsonBody)
+	testServer := httptest.NewServer(http.HandlerFunc(stub.Handle))
+	defer testServer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := newMonitor(t, monitor.SiteSpec{URL: testServer.URL, JSON: []monitor.JSONAssertion{
+		{Path: "status", Value: "ok"},
+		{Path: "db", Value: "up"},
+	}})
+
+	m.CheckSites(ctx)
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		m.Collect(ch)
+		close(ch)
+	}()
+
+	results := make(map[string]float64)
+	for metric := range ch {
+		if assertion := metrics.MetricLabel(metric, "assertion"); assertion != "" {
+			results[assertion] = metrics.MetricValue(metric).GetGauge().GetValue()
+		}
+	}
+	assert.Equal(t, map[string]float64{"status eq ok": 0.0, "db eq up": 1.0}, results)
+}
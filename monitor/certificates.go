@@ -0,0 +1,101 @@
+package monitor
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// Certificate contains the attributes of one certificate in the chain presented by a TLS site
+type Certificate struct {
+	// Position of the certificate in the chain. The site's own (leaf) certificate is at position zero
+	Position int `json:"position"`
+	// Subject of the certificate
+	Subject string `json:"subject"`
+	// Issuer of the certificate
+	Issuer string `json:"issuer"`
+	// Serial number of the certificate, in hexadecimal
+	Serial string `json:"serial"`
+	// Fingerprint is the SHA-256 fingerprint of the certificate, in hexadecimal
+	Fingerprint string `json:"fingerprint"`
+	// SANs lists the certificate's subject alternative names: DNS names, IP addresses, email addresses & URIs
+	SANs []string `json:"sans,omitempty"`
+	// NotAfter is the time when the certificate expires
+	NotAfter time.Time `json:"not_after"`
+	// Expiry is the number of days before the certificate expires
+	Expiry float64 `json:"expiry"`
+}
+
+// inspectChain returns the attributes of each certificate in the chain and the number of days before the first
+// certificate in the chain expires.
+func inspectChain(certificates []*x509.Certificate, now time.Time) (chain []Certificate, expiry float64) {
+	for position, certificate := range certificates {
+		entry := Certificate{
+			Position:    position,
+			Subject:     certificate.Subject.String(),
+			Issuer:      certificate.Issuer.String(),
+			Serial:      certificate.SerialNumber.Text(16),
+			Fingerprint: fingerprint(certificate),
+			SANs:        subjectAlternativeNames(certificate),
+			NotAfter:    certificate.NotAfter,
+			Expiry:      certificate.NotAfter.Sub(now).Hours() / 24,
+		}
+		if position == 0 || entry.Expiry < expiry {
+			expiry = entry.Expiry
+		}
+		chain = append(chain, entry)
+	}
+	return
+}
+
+func subjectAlternativeNames(certificate *x509.Certificate) (names []string) {
+	names = append(names, certificate.DNSNames...)
+	for _, ip := range certificate.IPAddresses {
+		names = append(names, ip.String())
+	}
+	names = append(names, certificate.EmailAddresses...)
+	for _, uri := range certificate.URIs {
+		names = append(names, uri.String())
+	}
+	return
+}
+
+// fingerprint returns the SHA-256 fingerprint of the certificate, in hexadecimal
+func fingerprint(certificate *x509.Certificate) string {
+	sum := sha256.Sum256(certificate.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// detectCertificateChange records the site's current certificate fingerprint & issuer and counts how often they
+// changed. previous is the site's last known state. If the check didn't return a certificate, the last known
+// fingerprint & issuer are kept.
+func (state *SiteState) detectCertificateChange(url string, previous *SiteState) {
+	if len(state.Certificates) > 0 {
+		state.Fingerprint, state.Issuer = state.Certificates[0].Fingerprint, state.Certificates[0].Issuer
+	}
+	if previous == nil {
+		return
+	}
+	state.CertificateChanges, state.IssuerChanges = previous.CertificateChanges, previous.IssuerChanges
+	if state.Fingerprint == "" {
+		state.Fingerprint, state.Issuer = previous.Fingerprint, previous.Issuer
+		return
+	}
+	if previous.Fingerprint == "" || previous.Fingerprint == state.Fingerprint {
+		return
+	}
+
+	state.CertificateChanges++
+	if previous.Issuer != state.Issuer {
+		state.IssuerChanges++
+	}
+	log.WithFields(log.Fields{
+		"site":            url,
+		"fingerprint":     state.Fingerprint,
+		"old_fingerprint": previous.Fingerprint,
+		"issuer":          state.Issuer,
+		"old_issuer":      previous.Issuer,
+	}).Warning("site certificate changed")
+}
@@ -0,0 +1,274 @@
+package monitor_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/clambin/gotools/metrics"
+	"github.com/clambin/webmon/monitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMonitor_CheckSites_CertificateChain(t *testing.T) {
+	root := newTestCA(t, "Test Root CA", nil, 10*365*24*time.Hour)
+	// the intermediate CA expires before the site's certificate
+	intermediate := newTestCA(t, "Test Intermediate CA", root, 10*24*time.Hour)
+	testServer := newTLSServer(t, intermediate.issue(t, 60*24*time.Hour, "localhost", "127.0.0.1"))
+	defer testServer.Close()
+
+	m := newMonitor(t, monitor.SiteSpec{URL: testServer.URL})
+	m.HTTPClient = newTLSClient(root)
+	m.CheckSites(context.Background())
+
+	entry, ok := m.GetEntry(testServer.URL)
+	require.True(t, ok)
+	require.NotNil(t, entry.State)
+	require.True(t, entry.State.Up, entry.State.LastError)
+	assert.True(t, entry.State.IsTLS)
+	assert.InDelta(t, 10.0, entry.State.CertificateAge, 0.1)
+
+	require.Len(t, entry.State.Certificates, 2)
+	leaf := entry.State.Certificates[0]
+	assert.Equal(t, 0, leaf.Position)
+	assert.Equal(t, "CN=localhost", leaf.Subject)
+	assert.Equal(t, "CN=Test Intermediate CA", leaf.Issuer)
+	assert.NotEmpty(t, leaf.Serial)
+	assert.Equal(t, []string{"localhost", "127.0.0.1"}, leaf.SANs)
+	assert.InDelta(t, 60.0, leaf.Expiry, 0.1)
+
+	ca := entry.State.Certificates[1]
+	assert.Equal(t, 1, ca.Position)
+	assert.Equal(t, "CN=Test Intermediate CA", ca.Subject)
+	assert.Equal(t, "CN=Test Root CA", ca.Issuer)
+	assert.Empty(t, ca.SANs)
+	assert.InDelta(t, 10.0, ca.Expiry, 0.1)
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		m.Collect(ch)
+		close(ch)
+	}()
+
+	expiry := make(map[string]float64)
+	for metric := range ch {
+		if metrics.MetricName(metric) == "webmon_certificate_chain_expiry" {
+			expiry[metrics.MetricLabel(metric, "position")+" "+metrics.MetricLabel(metric, "subject")] = metrics.MetricValue(metric).GetGauge().GetValue()
+		}
+	}
+	require.Len(t, expiry, 2)
+	assert.InDelta(t, 60.0, expiry["0 CN=localhost"], 0.1)
+	assert.InDelta(t, 10.0, expiry["1 CN=Test Intermediate CA"], 0.1)
+}
+
+func TestMonitor_CheckSites_CertificateChange(t *testing.T) {
+	root := newTestCA(t, "Test Root CA", nil, 365*24*time.Hour)
+	intermediate := newTestCA(t, "Test Intermediate CA", root, 365*24*time.Hour)
+
+	var certificate atomic.Value
+	certificate.Store(root.issue(t, 24*time.Hour, "127.0.0.1"))
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc((&serverStub{}).Handle))
+	testServer.TLS = &tls.Config{GetConfigForClient: func(_ *tls.ClientHelloInfo) (*tls.Config, error) {
+		return &tls.Config{Certificates: []tls.Certificate{certificate.Load().(tls.Certificate)}}, nil
+	}}
+	testServer.StartTLS()
+	defer testServer.Close()
+
+	m := newMonitor(t, monitor.SiteSpec{URL: testServer.URL})
+	m.HTTPClient = newTLSClient(root)
+
+	var fingerprints []string
+	for i, step := range []struct {
+		certificate   *tls.Certificate
+		changes       int
+		issuerChanges int
+		issuer        string
+	}{
+		{changes: 0, issuerChanges: 0, issuer: "CN=Test Root CA"},
+		{changes: 0, issuerChanges: 0, issuer: "CN=Test Root CA"},
+		// certificate is re-issued by the same CA
+		{certificate: newCertificate(root.issue(t, 24*time.Hour, "127.0.0.1")), changes: 1, issuerChanges: 0, issuer: "CN=Test Root CA"},
+		// certificate is issued by a different CA
+		{certificate: newCertificate(intermediate.issue(t, 24*time.Hour, "127.0.0.1")), changes: 2, issuerChanges: 1, issuer: "CN=Test Intermediate CA"},
+	} {
+		if step.certificate != nil {
+			certificate.Store(*step.certificate)
+		}
+		m.CheckSites(context.Background())
+
+		entry, ok := m.GetEntry(testServer.URL)
+		require.True(t, ok)
+		require.NotNil(t, entry.State)
+		require.True(t, entry.State.Up, entry.State.LastError)
+		assert.Len(t, entry.State.Fingerprint, 64, i)
+		assert.Equal(t, entry.State.Certificates[0].Fingerprint, entry.State.Fingerprint, i)
+		assert.Equal(t, step.issuer, entry.State.Issuer, i)
+		assert.Equal(t, step.changes, entry.State.CertificateChanges, i)
+		assert.Equal(t, step.issuerChanges, entry.State.IssuerChanges, i)
+		fingerprints = append(fingerprints, entry.State.Fingerprint)
+	}
+	assert.Equal(t, fingerprints[0], fingerprints[1])
+	assert.NotEqual(t, fingerprints[1], fingerprints[2])
+
+	// the last known certificate is kept when the site can't be reached
+	testServer.Close()
+	m.CheckSites(context.Background())
+	entry, _ := m.GetEntry(testServer.URL)
+	assert.False(t, entry.State.Up)
+	assert.Equal(t, fingerprints[3], entry.State.Fingerprint)
+	assert.Equal(t, 2, entry.State.CertificateChanges)
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		m.Collect(ch)
+		close(ch)
+	}()
+	changes := make(map[string]float64)
+	for metric := range ch {
+		changes[metrics.MetricName(metric)] = metrics.MetricValue(metric).GetCounter().GetValue()
+	}
+	assert.Equal(t, 2.0, changes["webmon_certificate_changes_total"])
+	assert.Equal(t, 1.0, changes["webmon_certificate_issuer_changes_total"])
+}
+
+func newCertificate(certificate tls.Certificate) *tls.Certificate {
+	return &certificate
+}
+
+// testCA is a certificate authority used to issue certificates for test servers
+type testCA struct {
+	certificate *x509.Certificate
+	key         crypto.Signer
+	chain       [][]byte
+}
+
+// newTestCA creates a new CA, valid for the specified duration. If parent is nil, the CA is self-signed.
+func newTestCA(t *testing.T, name string, parent *testCA, validity time.Duration) *testCA {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber:          newSerial(t),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	ca := &testCA{key: newKey(t)}
+	issuer, signer := template, ca.key
+	if parent != nil {
+		issuer, signer = parent.certificate, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, ca.key.Public(), signer)
+	require.NoError(t, err)
+	ca.certificate, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+	if parent != nil {
+		ca.chain = append([][]byte{der}, parent.chain...)
+	}
+	return ca
+}
+
+// issue creates a certificate for the specified hosts (names or IP addresses), valid for the specified duration.
+// Use a negative duration to create an expired certificate. The returned certificate includes the CA's chain,
+// up to (but not including) the root CA.
+func (ca *testCA) issue(t *testing.T, validity time.Duration, hosts ...string) tls.Certificate {
+	t.Helper()
+	return ca.issueWith(t, validity, nil, hosts...)
+}
+
+// issueWith creates a certificate like issue. If set, modify can change the certificate's template before it's signed.
+func (ca *testCA) issueWith(t *testing.T, validity time.Duration, modify func(template *x509.Certificate), hosts ...string) tls.Certificate {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: newSerial(t),
+		Subject:      pkix.Name{CommonName: hosts[0]},
+		NotBefore:    time.Now().Add(-365 * 24 * time.Hour),
+		NotAfter:     time.Now().Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	if modify != nil {
+		modify(template)
+	}
+	key := newKey(t)
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, key.Public(), ca.key)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: append([][]byte{der}, ca.chain...), PrivateKey: key, Leaf: leaf}
+}
+
+// pool returns a certificate pool that contains the CA's certificate
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.certificate)
+	return pool
+}
+
+// pem returns the CA's PEM-encoded certificate
+func (ca *testCA) pem() string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.certificate.Raw}))
+}
+
+// encodePEM returns the PEM-encoded certificate & private key
+func encodePEM(t *testing.T, certificate tls.Certificate) (cert, key string) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(certificate.PrivateKey)
+	require.NoError(t, err)
+	for _, block := range certificate.Certificate {
+		cert += string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: block}))
+	}
+	return cert, string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+// newTLSServer starts an HTTPS test server that presents the specified certificate
+func newTLSServer(t *testing.T, certificate tls.Certificate) *httptest.Server {
+	t.Helper()
+	stub := &serverStub{}
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(stub.Handle))
+	testServer.TLS = &tls.Config{Certificates: []tls.Certificate{certificate}}
+	testServer.StartTLS()
+	return testServer
+}
+
+// newTLSClient returns an HTTP client that trusts the specified root CA. Like the monitor's default client,
+// it sets up a new connection for each request.
+func newTLSClient(root *testCA) *http.Client {
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: root.pool()}, DisableKeepAlives: true}}
+}
+
+func newKey(t *testing.T) crypto.Signer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return key
+}
+
+func newSerial(t *testing.T) *big.Int {
+	t.Helper()
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	require.NoError(t, err)
+	return serial
+}
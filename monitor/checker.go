@@ -0,0 +1,32 @@
+package monitor
+
+import (
+	"context"
+)
+
+// A checker checks a site once. ctx contains the check's timeout. The site is up if the returned state's Up is set.
+type checker func(monitor *Monitor, ctx context.Context, site SiteSpec) *SiteState
+
+// checkers maps each supported URL scheme to the checker for that scheme
+var checkers = map[string]checker{
+	"http":              (*Monitor).checkHTTP,
+	"https":             (*Monitor).checkHTTP,
+	"tcp":               (*Monitor).checkTCP,
+	"dns":               (*Monitor).checkDNS,
+	"grpc":              (*Monitor).checkGRPC,
+	"grpcs":             (*Monitor).checkGRPC,
+	"ws":                (*Monitor).checkWebSocket,
+	"wss":               (*Monitor).checkWebSocket,
+	"tls":               (*Monitor).checkTLS,
+	"smtp+starttls":     (*Monitor).checkTLS,
+	"imap+starttls":     (*Monitor).checkTLS,
+	"ldap+starttls":     (*Monitor).checkTLS,
+	"postgres+starttls": (*Monitor).checkTLS,
+}
+
+// needsPort returns true if sites with the specified scheme must specify a port in their URL
+func needsPort(scheme string) bool {
+	_, startTLS := startTLSProtocols[scheme]
+	_, webSocket := webSocketPorts[scheme]
+	return (scheme == "http" || scheme == "https" || scheme == "dns" || startTLS || webSocket) == false
+}
@@ -2,90 +2,236 @@ package monitor
 
 import (
 	"context"
+	"fmt"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/sync/semaphore"
-	"net/http"
+	"io"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
 	"time"
 )
 
 // CheckSites checks each site. The site's status isn't reported here, but is kept internally to be scraped by Prometheus
-// using the Collect function.
+// using the Collect function. Each site's state is updated as soon as its check completes. The monitor isn't locked
+// while sites are being checked, so Collect and Health always return the last known state without waiting.
 func (monitor *Monitor) CheckSites(ctx context.Context) {
+	monitor.lock.RLock()
+	urls := make([]string, 0, len(monitor.sites))
+	for url := range monitor.sites {
+		urls = append(urls, url)
+	}
+	monitor.lock.RUnlock()
+
+	maxJobs := semaphore.NewWeighted(monitor.maxConcurrentChecks())
+	var wg sync.WaitGroup
+	for _, url := range urls {
+		if err := maxJobs.Acquire(ctx, 1); err != nil {
+			break
+		}
+		wg.Add(1)
+		go func(url string) {
+			monitor.checkAndUpdate(ctx, url)
+			maxJobs.Release(1)
+			wg.Done()
+		}(url)
+	}
+	wg.Wait()
+}
+
+// checkAndUpdate checks the site and stores the resulting state. The monitor isn't locked while the site is checked.
+func (monitor *Monitor) checkAndUpdate(ctx context.Context, url string) {
+	monitor.lock.RLock()
+	entry, ok := monitor.sites[url]
+	interval := monitor.siteInterval(entry.Spec)
+	monitor.lock.RUnlock()
+	if ok == false {
+		return
+	}
+
+	state := monitor.checkSite(ctx, entry.Spec, interval)
+
 	monitor.lock.Lock()
 	defer monitor.lock.Unlock()
+	if entry, ok = monitor.sites[url]; ok {
+		state.applyThresholds(entry.Spec, entry.State)
+		state.detectCertificateChange(url, entry.State)
+		entry.State = state
+		monitor.sites[url] = entry
+	}
+}
 
-	if monitor.MaxConcurrentChecks == 0 {
-		monitor.MaxConcurrentChecks = DefaultMaxConcurrentChecks
+// checkSite checks the site, retrying failed attempts as specified by the site's Retries and RetryBackoff. Retries
+// only start within the site's interval (if known), so they don't delay the site's next check.
+func (monitor *Monitor) checkSite(ctx context.Context, site SiteSpec, interval time.Duration) (state *SiteState) {
+	backoff := site.RetryBackoff.Duration
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	if backoff > MaxRetryBackoff {
+		backoff = MaxRetryBackoff
+	}
+	var deadline time.Time
+	if interval > 0 {
+		deadline = time.Now().Add(interval)
 	}
-	maxJobs := semaphore.NewWeighted(monitor.MaxConcurrentChecks)
 
-	responses := make(map[string]chan *SiteState)
-	for site := range monitor.sites {
-		responses[site] = make(chan *SiteState)
+	for attempt := 0; ; attempt++ {
+		state = monitor.checkAttempt(ctx, site)
+		state.Attempts = attempt + 1
+		if state.Up || attempt >= site.Retries {
+			break
+		}
+		if deadline.IsZero() == false && time.Now().Add(backoff).After(deadline) {
+			log.WithFields(log.Fields{"site": site.URL, "attempt": state.Attempts}).Debug("check failed. no time left to retry")
+			break
+		}
+		if wait(ctx, backoff) == false {
+			break
+		}
+		log.WithFields(log.Fields{"site": site.URL, "attempt": state.Attempts, "err": state.LastError}).Debug("check failed. retrying")
+		backoff = nextBackoff(backoff)
+	}
 
-		_ = maxJobs.Acquire(ctx, 1)
-		go func(ch chan *SiteState, site string) {
-			state := monitor.checkSite(ctx, site)
-			maxJobs.Release(1)
-			ch <- state
-		}(responses[site], site)
+	state.LastCheck = time.Now()
+	return
+}
+
+// checkAttempt checks the site once, using the checker for the site's URL scheme
+func (monitor *Monitor) checkAttempt(ctx context.Context, site SiteSpec) (state *SiteState) {
+	log.WithField("site", site.URL).Debug("checking site")
+
+	timeout := site.Timeout.Duration
+	if timeout <= 0 {
+		timeout = DefaultTimeout
 	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
-	for site, ch := range responses {
-		entry, _ := monitor.sites[site]
-		entry.State = <-ch
-		monitor.sites[site] = entry
+	target, err := url.Parse(site.URL)
+	if err != nil {
+		return &SiteState{LastError: err.Error()}
+	}
+	check, ok := checkers[target.Scheme]
+	if ok == false {
+		return &SiteState{LastError: fmt.Sprintf("unsupported scheme '%s'", target.Scheme)}
+	}
+	if site.ResolveTo != "" {
+		ctx = withPinnedAddress(ctx, target.Hostname(), site.ResolveTo)
 	}
+	if site.IPFamily == IPFamilyBoth {
+		return monitor.checkFamilies(ctx, site, target.Hostname(), check)
+	}
+	return monitor.checkHost(withIPFamily(ctx, site.IPFamily), site, target.Hostname(), check)
 }
 
-func (monitor *Monitor) checkSite(ctx context.Context, site string) (state *SiteState) {
-	log.WithField("site", site).Debug("checking site")
+// checkHTTP checks an HTTP(S) site
+func (monitor *Monitor) checkHTTP(ctx context.Context, site SiteSpec) (state *SiteState) {
+	state = &SiteState{}
+	codes, err := parseStatusCodes(site.StatusCodes)
+	if err != nil {
+		state.LastError = err.Error()
+		return
+	}
+
+	req, err := newRequest(ctx, site)
+	if err != nil {
+		state.LastError = "failed to create request: " + err.Error()
+		return
+	}
+
+	t := &tracer{}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), t.trace()))
 
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, site, nil)
+	client, tlsConfig, release, err := monitor.siteClient(site)
+	if err != nil {
+		state.LastError = "invalid TLS configuration: " + err.Error()
+		return
+	}
+	defer release()
 
 	start := time.Now()
-	resp, err := monitor.HTTPClient.Do(req)
+	resp, err := client.Do(req)
 
-	state = &SiteState{}
 	if err != nil {
-		state.LastError = err.Error()
+		state.setConnectionError(err)
 		return
 	}
+	if forwarded(site) {
+		if err = forwardError(resp); err != nil {
+			_ = resp.Body.Close()
+			state.setConnectionError(err)
+			return
+		}
+	}
 
 	state.HTTPCode = resp.StatusCode
-	state.Up = goodStatusCode(resp.StatusCode)
-	state.Latency = Duration{Duration: time.Now().Sub(start)}
+	state.Up = codes.match(resp.StatusCode)
+	if state.Up == false {
+		state.LastError = fmt.Sprintf("unexpected HTTP status code %d (expected: %s)", resp.StatusCode, codes)
+	}
+
+	content, err := readBody(site, resp.Body)
+	done := time.Now()
+	state.Latency = Duration{Duration: done.Sub(start)}
+	state.Timings, state.ConnectionReused = t.timings(done)
+
+	if err != nil {
+		if state.Up {
+			state.Up = false
+			state.LastError = err.Error()
+		}
+	} else if state.Up && (site.Content != nil || len(site.JSON) > 0) {
+		if err = checkBody(site, content, state); err != nil {
+			state.Up = false
+			state.LastError = err.Error()
+		}
+	}
+
+	if len(site.JSON) > 0 && state.Assertions == nil {
+		// the response body wasn't checked (e.g. unexpected status code), so none of the assertions passed
+		state.Assertions = failedAssertions(site.JSON)
+	}
 
 	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
-		state.IsTLS = true
-		state.CertificateAge = resp.TLS.PeerCertificates[0].NotAfter.Sub(time.Now()).Hours() / 24
+		monitor.inspectTLS(ctx, site, resp.TLS, tlsConfig, req.URL.Hostname(), state)
 	}
 
 	_ = resp.Body.Close()
 
-	state.LastCheck = time.Now()
-
 	log.WithError(err).WithFields(log.Fields{
-		"site":    site,
+		"site":    site.URL,
 		"up":      state.Up,
 		"certAge": state.CertificateAge,
 		"latency": state.Latency,
-	}).Debug("checkSite")
+	}).Debug("checkHTTP")
 	return
 }
 
-var goodHTTPStatusCodes = []int{
-	http.StatusOK,
-	http.StatusUnauthorized,
-	http.StatusTemporaryRedirect,
-	http.StatusFound,
+// readBody reads the response body, up to the site's maximum content size
+func readBody(site SiteSpec, body io.Reader) (content []byte, err error) {
+	maxSize := int64(DefaultMaxContentSize)
+	if site.Content != nil && site.Content.MaxSize > 0 {
+		maxSize = site.Content.MaxSize
+	}
+
+	if content, err = io.ReadAll(io.LimitReader(body, maxSize)); err != nil {
+		err = fmt.Errorf("failed to read response body: %w", err)
+	}
+	return
 }
 
-func goodStatusCode(statusCode int) bool {
-	for _, code := range goodHTTPStatusCodes {
-		if statusCode == code {
-			return true
+// checkBody checks the site's content & JSON assertions. It returns an error for the first assertion that failed.
+func checkBody(site SiteSpec, content []byte, state *SiteState) (err error) {
+	if site.Content != nil {
+		err = site.Content.check(content)
+	}
+	if len(site.JSON) > 0 {
+		var jsonErr error
+		state.Assertions, jsonErr = checkJSON(site.JSON, content)
+		if err == nil {
+			err = jsonErr
 		}
 	}
-	return false
+	return err
 }
@@ -3,11 +3,131 @@ package monitor_test
 import (
 	"context"
 	"github.com/clambin/webmon/monitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
+func TestMonitor_CheckSites_StatusCodes(t *testing.T) {
+	stub := &serverStub{}
+	testServer := httptest.NewServer(http.HandlerFunc(stub.Handle))
+	defer testServer.Close()
+
+	testCases := []struct {
+		name        string
+		statusCodes string
+		statusCode  int
+		up          bool
+		lastError   string
+	}{
+		{name: "default", statusCode: http.StatusOK, up: true},
+		{name: "default - fail", statusCode: http.StatusNoContent, up: false, lastError: "unexpected HTTP status code 204 (expected: 200,401,307,302)"},
+		{name: "range", statusCodes: "200-299,401", statusCode: http.StatusNoContent, up: true},
+		{name: "range - fail", statusCodes: "200-299, 401", statusCode: http.StatusFound, up: false, lastError: "unexpected HTTP status code 302 (expected: 200-299,401)"},
+		{name: "single", statusCodes: "401", statusCode: http.StatusUnauthorized, up: true},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			m := newMonitor(t, monitor.SiteSpec{URL: testServer.URL, StatusCodes: tt.statusCodes})
+
+			stub.StatusCode(tt.statusCode)
+			m.CheckSites(ctx)
+
+			entry, ok := m.GetEntry(testServer.URL)
+			require.True(t, ok)
+			require.NotNil(t, entry.State)
+			assert.Equal(t, tt.up, entry.State.Up)
+			assert.Equal(t, tt.lastError, entry.State.LastError)
+		})
+	}
+}
+
+func TestMonitor_CheckSites_Timeout(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-req.Context().Done():
+		case <-time.After(time.Second):
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := newMonitor(t, monitor.SiteSpec{URL: testServer.URL, Timeout: monitor.Duration{Duration: 50 * time.Millisecond}})
+
+	start := time.Now()
+	m.CheckSites(ctx)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	entry, ok := m.GetEntry(testServer.URL)
+	require.True(t, ok)
+	require.NotNil(t, entry.State)
+	assert.False(t, entry.State.Up)
+	assert.Contains(t, entry.State.LastError, "context deadline exceeded")
+}
+
+func TestMonitor_CheckSites_NotBlocking(t *testing.T) {
+	stub := &serverStub{}
+	testServer := httptest.NewServer(http.HandlerFunc(stub.Handle))
+	defer testServer.Close()
+
+	slow := make(chan struct{})
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-slow
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer slowServer.Close()
+
+	m := monitor.New([]string{testServer.URL, slowServer.URL})
+	done := make(chan struct{})
+	go func() {
+		m.CheckSites(context.Background())
+		close(done)
+	}()
+
+	// the fast site's state is available before the slow site's check completes
+	assert.Eventually(t, func() bool {
+		entry, ok := m.GetEntry(testServer.URL)
+		return ok && entry.State != nil && entry.State.Up
+	}, time.Second, 10*time.Millisecond)
+
+	// scrapes don't wait for the slow site
+	ch := make(chan prometheus.Metric, 100)
+	collected := make(chan struct{})
+	go func() {
+		m.Collect(ch)
+		close(collected)
+	}()
+	select {
+	case <-collected:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("Collect blocked while sites were being checked")
+	}
+
+	w := httptest.NewRecorder()
+	m.Health(w, &http.Request{})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	close(slow)
+	<-done
+}
+
+// newMonitor creates a new Monitor for the provided site
+func newMonitor(t *testing.T, site monitor.SiteSpec) *monitor.Monitor {
+	t.Helper()
+	m := monitor.New(nil)
+	require.NoError(t, m.AddSite(site))
+	return m
+}
+
 func BenchmarkMonitor_CheckSites(b *testing.B) {
 	stub := &serverStub{}
 	testServer := httptest.NewTLSServer(http.HandlerFunc(stub.Handle))
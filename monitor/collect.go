@@ -3,6 +3,7 @@ package monitor
 import (
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
+	"strconv"
 	"time"
 )
 
@@ -19,6 +20,96 @@ var (
 		[]string{"site_url", "site_name"},
 		nil,
 	)
+	metricRoundTrip = prometheus.NewDesc(
+		prometheus.BuildFQName("webmon", "site", "round_trip_seconds"),
+		"Time between sending a message to a WebSocket site and receiving the expected reply, in seconds",
+		[]string{"site_url", "site_name"},
+		nil,
+	)
+	metricAddressUp = prometheus.NewDesc(
+		prometheus.BuildFQName("webmon", "site", "address_up"),
+		"Set to 1 if the site is up at the IP address",
+		[]string{"site_url", "site_name", "address"},
+		nil,
+	)
+	metricAddressLatency = prometheus.NewDesc(
+		prometheus.BuildFQName("webmon", "site", "address_latency_seconds"),
+		"Time to check the site at the IP address, in seconds",
+		[]string{"site_url", "site_name", "address"},
+		nil,
+	)
+	metricFamilyUp = prometheus.NewDesc(
+		prometheus.BuildFQName("webmon", "site", "family_up"),
+		"Set to 1 if the site is up over the IP family",
+		[]string{"site_url", "site_name", "family"},
+		nil,
+	)
+	metricFamilyLatency = prometheus.NewDesc(
+		prometheus.BuildFQName("webmon", "site", "family_latency_seconds"),
+		"Time to check the site over the IP family, in seconds",
+		[]string{"site_url", "site_name", "family"},
+		nil,
+	)
+	metricProxyError = prometheus.NewDesc(
+		prometheus.BuildFQName("webmon", "site", "proxy_error"),
+		"Set to 1 if the connection to the site couldn't be tunnelled through the site's proxy",
+		[]string{"site_url", "site_name"},
+		nil,
+	)
+	metricPhaseLatency = prometheus.NewDesc(
+		prometheus.BuildFQName("webmon", "site", "phase_latency_seconds"),
+		"Duration of each phase of the site's check, in seconds",
+		[]string{"site_url", "site_name", "phase"},
+		nil,
+	)
+	metricAssertionFailed = prometheus.NewDesc(
+		prometheus.BuildFQName("webmon", "site", "assertion_failed"),
+		"Set to 1 if the JSON or DNS assertion failed",
+		[]string{"site_url", "site_name", "assertion"},
+		nil,
+	)
+	metricChainExpiry = prometheus.NewDesc(
+		prometheus.BuildFQName("webmon", "certificate", "chain_expiry"),
+		"Number of days before each certificate in the site's certificate chain expires",
+		[]string{"site_url", "site_name", "position", "subject"},
+		nil,
+	)
+	metricCertValid = prometheus.NewDesc(
+		prometheus.BuildFQName("webmon", "certificate", "valid"),
+		"Set to 1 if the site's certificate passed verification. reason contains why verification failed",
+		[]string{"site_url", "site_name", "reason"},
+		nil,
+	)
+	metricTLSInfo = prometheus.NewDesc(
+		prometheus.BuildFQName("webmon", "tls", "info"),
+		"Negotiated TLS version & cipher suite and the site certificate's key type, key size & signature algorithm",
+		[]string{"site_url", "site_name", "version", "cipher_suite", "key_type", "key_size", "signature_algorithm"},
+		nil,
+	)
+	metricCertChanges = prometheus.NewDesc(
+		prometheus.BuildFQName("webmon", "certificate", "changes_total"),
+		"Number of times the site's certificate changed",
+		[]string{"site_url", "site_name"},
+		nil,
+	)
+	metricIssuerChanges = prometheus.NewDesc(
+		prometheus.BuildFQName("webmon", "certificate", "issuer_changes_total"),
+		"Number of times the issuer of the site's certificate changed",
+		[]string{"site_url", "site_name"},
+		nil,
+	)
+	metricRevocation = prometheus.NewDesc(
+		prometheus.BuildFQName("webmon", "certificate", "revocation_status"),
+		"Revocation status of the site's certificate (good, revoked or unknown) and where it was obtained",
+		[]string{"site_url", "site_name", "status", "source"},
+		nil,
+	)
+	metricFailureStreak = prometheus.NewDesc(
+		prometheus.BuildFQName("webmon", "site", "failure_streak"),
+		"Number of consecutive failed checks",
+		[]string{"site_url", "site_name"},
+		nil,
+	)
 	metricCertAge = prometheus.NewDesc(
 		prometheus.BuildFQName("webmon", "certificate", "expiry"),
 		"Number of days before the HTTPS certificate expires",
@@ -32,6 +123,21 @@ func (monitor *Monitor) Describe(ch chan<- *prometheus.Desc) {
 	ch <- metricUp
 	ch <- metricLatency
 	ch <- metricCertAge
+	ch <- metricAssertionFailed
+	ch <- metricPhaseLatency
+	ch <- metricFailureStreak
+	ch <- metricChainExpiry
+	ch <- metricCertValid
+	ch <- metricTLSInfo
+	ch <- metricCertChanges
+	ch <- metricIssuerChanges
+	ch <- metricRevocation
+	ch <- metricRoundTrip
+	ch <- metricAddressUp
+	ch <- metricAddressLatency
+	ch <- metricFamilyUp
+	ch <- metricFamilyLatency
+	ch <- metricProxyError
 }
 
 // Collect implements the prometheus collector Collect interface
@@ -46,17 +152,102 @@ func (monitor *Monitor) Collect(ch chan<- prometheus.Metric) {
 			if name == "" {
 				name = url
 			}
-			if entry.State.Up {
+			if entry.State.Up && entry.State.MaskedError != "" {
+				// the check failed, but the site's FailureThreshold hasn't been reached: there are no measurements to report
+				ch <- prometheus.MustNewConstMetric(metricUp, prometheus.GaugeValue, 1.0, url, name)
+			} else if entry.State.Up {
 				ch <- prometheus.MustNewConstMetric(metricUp, prometheus.GaugeValue, 1.0, url, name)
 				ch <- prometheus.MustNewConstMetric(metricLatency, prometheus.GaugeValue, entry.State.Latency.Seconds(), url, name)
 				if entry.State.IsTLS {
 					ch <- prometheus.MustNewConstMetric(metricCertAge, prometheus.GaugeValue, entry.State.CertificateAge, url, name)
+					for _, certificate := range entry.State.Certificates {
+						ch <- prometheus.MustNewConstMetric(metricChainExpiry, prometheus.GaugeValue, certificate.Expiry, url, name, strconv.Itoa(certificate.Position), certificate.Subject)
+					}
 				}
+				if entry.State.RoundTrip != nil {
+					ch <- prometheus.MustNewConstMetric(metricRoundTrip, prometheus.GaugeValue, entry.State.RoundTrip.Seconds(), url, name)
+				}
+				collectTimings(ch, entry.State, url, name)
 			} else {
 				ch <- prometheus.MustNewConstMetric(metricUp, prometheus.GaugeValue, 0.0, url, name)
 			}
+			if entry.State.TLSVersion != "" {
+				ch <- prometheus.MustNewConstMetric(metricTLSInfo, prometheus.GaugeValue, 1.0, url, name,
+					entry.State.TLSVersion, entry.State.CipherSuite, entry.State.KeyType, strconv.Itoa(entry.State.KeySize), entry.State.SignatureAlgorithm)
+			}
+			if entry.State.Fingerprint != "" {
+				ch <- prometheus.MustNewConstMetric(metricCertChanges, prometheus.CounterValue, float64(entry.State.CertificateChanges), url, name)
+				ch <- prometheus.MustNewConstMetric(metricIssuerChanges, prometheus.CounterValue, float64(entry.State.IssuerChanges), url, name)
+			}
+			if entry.State.Revocation != "" {
+				ch <- prometheus.MustNewConstMetric(metricRevocation, prometheus.GaugeValue, 1.0, url, name, entry.State.Revocation, entry.State.RevocationSource)
+			}
+			if result := entry.State.TLSVerification; result != "" {
+				valid, reason := 1.0, ""
+				if result != TLSVerificationOK {
+					valid, reason = 0.0, result
+				}
+				ch <- prometheus.MustNewConstMetric(metricCertValid, prometheus.GaugeValue, valid, url, name, reason)
+			}
+			collectAddresses(ch, entry.State, url, name)
+			collectFamilies(ch, entry.State, url, name)
+			if entry.Spec.Proxy.enabled() {
+				proxyError := 0.0
+				if entry.State.ProxyError != "" {
+					proxyError = 1.0
+				}
+				ch <- prometheus.MustNewConstMetric(metricProxyError, prometheus.GaugeValue, proxyError, url, name)
+			}
+			ch <- prometheus.MustNewConstMetric(metricFailureStreak, prometheus.GaugeValue, float64(entry.State.FailureStreak), url, name)
+			for assertion, ok := range entry.State.Assertions {
+				failed := 0.0
+				if ok == false {
+					failed = 1.0
+				}
+				ch <- prometheus.MustNewConstMetric(metricAssertionFailed, prometheus.GaugeValue, failed, url, name, assertion)
+			}
 		}
 	}
 
 	log.WithField("duration", time.Now().Sub(start)).Debug("prometheus scrape done")
 }
+
+func collectAddresses(ch chan<- prometheus.Metric, state *SiteState, url, name string) {
+	for _, address := range state.Addresses {
+		if address.Up {
+			ch <- prometheus.MustNewConstMetric(metricAddressUp, prometheus.GaugeValue, 1.0, url, name, address.Address)
+			ch <- prometheus.MustNewConstMetric(metricAddressLatency, prometheus.GaugeValue, address.Latency.Seconds(), url, name, address.Address)
+		} else {
+			ch <- prometheus.MustNewConstMetric(metricAddressUp, prometheus.GaugeValue, 0.0, url, name, address.Address)
+		}
+	}
+}
+
+func collectFamilies(ch chan<- prometheus.Metric, state *SiteState, url, name string) {
+	for _, family := range state.Families {
+		if family.Up {
+			ch <- prometheus.MustNewConstMetric(metricFamilyUp, prometheus.GaugeValue, 1.0, url, name, family.Family)
+			ch <- prometheus.MustNewConstMetric(metricFamilyLatency, prometheus.GaugeValue, family.Latency.Seconds(), url, name, family.Family)
+		} else {
+			ch <- prometheus.MustNewConstMetric(metricFamilyUp, prometheus.GaugeValue, 0.0, url, name, family.Family)
+		}
+	}
+}
+
+func collectTimings(ch chan<- prometheus.Metric, state *SiteState, url, name string) {
+	if state.Timings == nil {
+		return
+	}
+	phases := map[string]Duration{
+		"dns":      state.Timings.DNS,
+		"connect":  state.Timings.Connect,
+		"ttfb":     state.Timings.TTFB,
+		"transfer": state.Timings.Transfer,
+	}
+	if state.IsTLS {
+		phases["tls"] = state.Timings.TLS
+	}
+	for phase, duration := range phases {
+		ch <- prometheus.MustNewConstMetric(metricPhaseLatency, prometheus.GaugeValue, duration.Seconds(), url, name, phase)
+	}
+}
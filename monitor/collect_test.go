@@ -6,8 +6,10 @@ import (
 	"github.com/clambin/webmon/monitor"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -50,7 +52,10 @@ func TestCollector_Collect(t *testing.T) {
 	}()
 
 	ch := make(chan prometheus.Metric)
-	go m.Collect(ch)
+	go func() {
+		m.Collect(ch)
+		close(ch)
+	}()
 
 	metric := <-ch
 	assert.Equal(t, 1.0, metrics.MetricValue(metric).GetGauge().GetValue())
@@ -60,6 +65,8 @@ func TestCollector_Collect(t *testing.T) {
 	assert.NotZero(t, metrics.MetricValue(metric).GetGauge().GetValue())
 	// metric = <-ch
 	// assert.Zero(t, metricValue(metric).GetGauge().GetValue())
+	for range ch {
+	}
 
 	cancel()
 
@@ -89,7 +96,10 @@ func TestCollector_Collect_TLS(t *testing.T) {
 	}()
 
 	ch := make(chan prometheus.Metric)
-	go m.Collect(ch)
+	go func() {
+		m.Collect(ch)
+		close(ch)
+	}()
 
 	metric := <-ch
 	assert.Equal(t, 1.0, metrics.MetricValue(metric).GetGauge().GetValue())
@@ -98,11 +108,50 @@ func TestCollector_Collect_TLS(t *testing.T) {
 	metric = <-ch
 	assert.NotZero(t, metrics.MetricValue(metric).GetGauge().GetValue())
 
+	phases := make(map[string]float64)
+	for metric = range ch {
+		if phase := metrics.MetricLabel(metric, "phase"); phase != "" {
+			phases[phase] = metrics.MetricValue(metric).GetGauge().GetValue()
+		}
+	}
+	assert.Len(t, phases, 5)
+	for _, phase := range []string{"connect", "tls", "ttfb"} {
+		assert.NotZero(t, phases[phase], phase)
+	}
+
 	cancel()
 
 	wg.Wait()
 }
 
+func TestMonitor_CheckSites_Timings(t *testing.T) {
+	stub := &serverStub{}
+	stub.Body("hello world")
+	testServer := httptest.NewServer(http.HandlerFunc(stub.Handle))
+	defer testServer.Close()
+
+	// use a hostname, so the DNS phase is measured too
+	url := strings.Replace(testServer.URL, "127.0.0.1", "localhost", 1)
+	m := monitor.New([]string{url})
+
+	for i := 0; i < 2; i++ {
+		m.CheckSites(context.Background())
+
+		entry, ok := m.GetEntry(url)
+		require.True(t, ok)
+		require.NotNil(t, entry.State)
+		require.NotNil(t, entry.State.Timings)
+		assert.True(t, entry.State.Up)
+		// keep-alives are disabled: each check sets up a new connection
+		assert.False(t, entry.State.ConnectionReused)
+		assert.NotZero(t, entry.State.Timings.DNS.Duration)
+		assert.NotZero(t, entry.State.Timings.Connect.Duration)
+		assert.Zero(t, entry.State.Timings.TLS.Duration)
+		assert.NotZero(t, entry.State.Timings.TTFB.Duration)
+		assert.LessOrEqual(t, entry.State.Timings.Connect.Duration+entry.State.Timings.TTFB.Duration, entry.State.Latency.Duration)
+	}
+}
+
 func TestCollector_Collect_StatusCodes(t *testing.T) {
 	stub := &serverStub{}
 	testServer := httptest.NewTLSServer(http.HandlerFunc(stub.Handle))
@@ -131,11 +180,15 @@ func TestCollector_Collect_StatusCodes(t *testing.T) {
 
 		m.CheckSites(ctx)
 
-		// use a buffered channel so Collect doesn't block when we don't read all metrics
-		ch := make(chan prometheus.Metric, 3)
-		go m.Collect(ch)
+		ch := make(chan prometheus.Metric)
+		go func() {
+			m.Collect(ch)
+			close(ch)
+		}()
 
 		up := metrics.MetricValue(<-ch).GetGauge().GetValue()
+		for range ch {
+		}
 
 		assert.Equal(t, testCase.up, up)
 	}
@@ -143,6 +196,7 @@ func TestCollector_Collect_StatusCodes(t *testing.T) {
 
 type serverStub struct {
 	statusCode int
+	body       string
 	lock       sync.RWMutex
 }
 
@@ -152,6 +206,12 @@ func (stub *serverStub) StatusCode(statusCode int) {
 	stub.statusCode = statusCode
 }
 
+func (stub *serverStub) Body(body string) {
+	stub.lock.Lock()
+	defer stub.lock.Unlock()
+	stub.body = body
+}
+
 func (stub *serverStub) Handle(w http.ResponseWriter, _ *http.Request) {
 	stub.lock.RLock()
 	defer stub.lock.RUnlock()
@@ -161,4 +221,5 @@ func (stub *serverStub) Handle(w http.ResponseWriter, _ *http.Request) {
 	}
 
 	w.WriteHeader(stub.statusCode)
+	_, _ = w.Write([]byte(stub.body))
 }
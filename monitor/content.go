@@ -0,0 +1,47 @@
+package monitor
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+)
+
+// DefaultMaxContentSize is the default maximum number of bytes read from a site's response body
+const DefaultMaxContentSize = 1 << 20
+
+// A ContentSpec specifies the assertions that a site's response body must meet for the site to be considered up
+type ContentSpec struct {
+	// Contains lists the strings that the response body must contain
+	Contains []string `json:"contains,omitempty"`
+	// NotContains lists the strings that the response body may not contain
+	NotContains []string `json:"not_contains,omitempty"`
+	// Matches lists the regular expressions that the response body must match
+	Matches []string `json:"matches,omitempty"`
+	// MaxSize is the maximum number of bytes that are read from the response body. This also applies to
+	// JSON assertions. Default: DefaultMaxContentSize
+	MaxSize int64 `json:"max_size,omitempty"`
+}
+
+// check verifies that the content meets all assertions. It returns an error for the first failed assertion.
+func (spec *ContentSpec) check(content []byte) error {
+	for _, text := range spec.Contains {
+		if bytes.Contains(content, []byte(text)) == false {
+			return fmt.Errorf("response body does not contain \"%s\"", text)
+		}
+	}
+	for _, text := range spec.NotContains {
+		if bytes.Contains(content, []byte(text)) {
+			return fmt.Errorf("response body contains \"%s\"", text)
+		}
+	}
+	for _, expression := range spec.Matches {
+		re, err := regexp.Compile(expression)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression \"%s\": %w", expression, err)
+		}
+		if re.Match(content) == false {
+			return fmt.Errorf("response body does not match \"%s\"", expression)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package monitor_test
+
+import (
+	"context"
+	"github.com/clambin/webmon/monitor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMonitor_CheckSites_Content(t *testing.T) {
+	stub := &serverStub{}
+	testServer := httptest.NewServer(http.HandlerFunc(stub.Handle))
+	defer testServer.Close()
+
+	testCases := []struct {
+		name      string
+		body      string
+		content   monitor.ContentSpec
+		up        bool
+		lastError string
+	}{
+		{name: "contains", body: "hello world", content: monitor.ContentSpec{Contains: []string{"hello", "world"}}, up: true},
+		{name: "contains - fail", body: "Maintenance mode", content: monitor.ContentSpec{Contains: []string{"hello"}}, lastError: `response body does not contain "hello"`},
+		{name: "not contains", body: "hello world", content: monitor.ContentSpec{NotContains: []string{"Maintenance"}}, up: true},
+		{name: "not contains - fail", body: "Maintenance mode", content: monitor.ContentSpec{NotContains: []string{"Maintenance"}}, lastError: `response body contains "Maintenance"`},
+		{name: "matches", body: "version: 1.2.3", content: monitor.ContentSpec{Matches: []string{`version: \d+\.\d+\.\d+`}}, up: true},
+		{name: "matches - fail", body: "version: unknown", content: monitor.ContentSpec{Matches: []string{`version: \d+`}}, lastError: `response body does not match "version: \d+"`},
+		{name: "max size", body: "hello world", content: monitor.ContentSpec{Contains: []string{"world"}, MaxSize: 5}, lastError: `response body does not contain "world"`},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			content := tt.content
+			m := newMonitor(t, monitor.SiteSpec{URL: testServer.URL, Content: &content})
+
+			stub.Body(tt.body)
+			m.CheckSites(ctx)
+
+			entry, ok := m.GetEntry(testServer.URL)
+			require.True(t, ok)
+			require.NotNil(t, entry.State)
+			assert.Equal(t, tt.up, entry.State.Up)
+			assert.Equal(t, tt.lastError, entry.State.LastError)
+		})
+	}
+}
@@ -0,0 +1,348 @@
+package monitor
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"golang.org/x/net/dns/dnsmessage"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDNSPort is the port of the resolver used by a DNS site, if the site's URL doesn't specify a port
+const DefaultDNSPort = "53"
+
+// maxDNSMessageSize is the maximum size of a DNS response
+const maxDNSMessageSize = 65535
+
+// dnsTypes contains the record types that can be queried by a DNS site, i.e. the supported values of the URL's
+// "type" parameter
+var dnsTypes = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"CNAME": dnsmessage.TypeCNAME,
+	"MX":    dnsmessage.TypeMX,
+	"NS":    dnsmessage.TypeNS,
+	"TXT":   dnsmessage.TypeTXT,
+	"SOA":   dnsmessage.TypeSOA,
+}
+
+// rCodes contains the names of the DNS response codes, as reported in SiteState.DNSResponseCode
+var rCodes = map[dnsmessage.RCode]string{
+	dnsmessage.RCodeSuccess:        "NOERROR",
+	dnsmessage.RCodeFormatError:    "FORMERR",
+	dnsmessage.RCodeServerFailure:  "SERVFAIL",
+	dnsmessage.RCodeNameError:      "NXDOMAIN",
+	dnsmessage.RCodeNotImplemented: "NOTIMP",
+	dnsmessage.RCodeRefused:        "REFUSED",
+}
+
+// A DNSSpec contains the assertions on the answer of a DNS site (dns://resolver/name?type=A). The site is up if the
+// resolver answers the query with at least one record of the requested type and all assertions are met.
+type DNSSpec struct {
+	// Addresses lists the IP addresses that the answer must contain
+	Addresses []string `json:"addresses,omitempty"`
+	// CNAME is the canonical name that the name must resolve to
+	CNAME string `json:"cname,omitempty"`
+	// MinTTL is the minimum TTL of the records in the answer
+	MinTTL Duration `json:"min_ttl,omitempty"`
+	// NXDomain expects the name not to exist: the site is up if the resolver answers NXDOMAIN
+	NXDomain bool `json:"nxdomain,omitempty"`
+}
+
+// dnsQuery is the query performed by a DNS site, as specified in the site's URL
+type dnsQuery struct {
+	resolver  string
+	name      dnsmessage.Name
+	queryType dnsmessage.Type
+}
+
+// parseDNSQuery parses a DNS site's URL
+func parseDNSQuery(target *url.URL) (query dnsQuery, err error) {
+	query.resolver = target.Host
+	if target.Port() == "" {
+		query.resolver = net.JoinHostPort(target.Hostname(), DefaultDNSPort)
+	}
+
+	name := strings.TrimPrefix(target.Path, "/")
+	if name == "" {
+		return query, errors.New("missing name")
+	}
+	if strings.HasSuffix(name, ".") == false {
+		name += "."
+	}
+	if query.name, err = dnsmessage.NewName(name); err != nil {
+		return query, fmt.Errorf("invalid name '%s': %w", name, err)
+	}
+
+	queryType := strings.ToUpper(target.Query().Get("type"))
+	if queryType == "" {
+		queryType = "A"
+	}
+	var ok bool
+	if query.queryType, ok = dnsTypes[queryType]; ok == false {
+		return query, fmt.Errorf("unsupported query type '%s'", queryType)
+	}
+	return query, nil
+}
+
+func (spec *DNSSpec) validate() error {
+	for _, address := range spec.Addresses {
+		if net.ParseIP(address) == nil {
+			return fmt.Errorf("dns: invalid address '%s'", address)
+		}
+	}
+	if spec.MinTTL.Duration < 0 {
+		return errors.New("dns: minimum TTL cannot be negative")
+	}
+	if spec.NXDomain && (len(spec.Addresses) > 0 || spec.CNAME != "" || spec.MinTTL.Duration > 0) {
+		return errors.New("dns: nxdomain cannot be combined with other assertions")
+	}
+	return nil
+}
+
+// checkDNS checks a DNS site. The site's latency is the time it took to resolve the name. If the query fails, or the
+// resolver returns an error, the reason is reported in DNSError.
+func (monitor *Monitor) checkDNS(ctx context.Context, site SiteSpec) (state *SiteState) {
+	state = &SiteState{}
+	target, err := url.Parse(site.URL)
+	if err != nil {
+		state.LastError = err.Error()
+		return
+	}
+	query, err := parseDNSQuery(target)
+	if err != nil {
+		state.LastError = err.Error()
+		return
+	}
+
+	start := time.Now()
+	response, err := resolve(ctx, query)
+	if err != nil {
+		state.DNSError = err.Error()
+		state.LastError = "dns: " + err.Error()
+		return
+	}
+	state.Latency = Duration{Duration: time.Since(start)}
+	state.DNSResponseCode = rCodeName(response.RCode)
+
+	spec := site.DNS
+	if spec == nil {
+		spec = &DNSSpec{}
+	}
+	nxDomain := response.RCode == dnsmessage.RCodeNameError
+	if spec.NXDomain && (nxDomain || response.RCode == dnsmessage.RCodeSuccess) {
+		state.Assertions = map[string]bool{"nxdomain": nxDomain}
+		if state.Up = nxDomain; state.Up == false {
+			state.LastError = "expected NXDOMAIN, got " + state.DNSResponseCode
+		}
+		return
+	}
+	if response.RCode != dnsmessage.RCodeSuccess {
+		state.DNSError = state.DNSResponseCode
+		state.LastError = "dns: " + state.DNSResponseCode
+		return
+	}
+
+	answers := response.Answers
+	state.DNSAnswers = make([]string, 0, len(answers))
+	found := false
+	for _, answer := range answers {
+		state.DNSAnswers = append(state.DNSAnswers, typeName(answer.Header.Type)+" "+recordValue(answer.Body))
+		found = found || answer.Header.Type == query.queryType
+	}
+	if found == false {
+		state.DNSError = "no " + typeName(query.queryType) + " records found"
+		state.LastError = "dns: " + state.DNSError
+		return
+	}
+
+	state.Assertions, err = spec.check(answers)
+	if state.Up = err == nil; state.Up == false {
+		state.LastError = err.Error()
+	}
+	return
+}
+
+// check checks the answers against the DNSSpec's assertions. It returns the result of each assertion (keyed by the
+// assertion's description) and an error describing the first failed assertion.
+func (spec *DNSSpec) check(answers []dnsmessage.Resource) (results map[string]bool, err error) {
+	record := func(assertion string, failure error) {
+		if results == nil {
+			results = make(map[string]bool)
+		}
+		results[assertion] = failure == nil
+		if err == nil {
+			err = failure
+		}
+	}
+
+	for _, address := range spec.Addresses {
+		expected := net.ParseIP(address)
+		var failure error = fmt.Errorf("address %s not found", address)
+		for _, answer := range answers {
+			if ip := recordAddress(answer.Body); ip != nil && ip.Equal(expected) {
+				failure = nil
+				break
+			}
+		}
+		record("address "+address, failure)
+	}
+
+	if spec.CNAME != "" {
+		expected := strings.TrimSuffix(strings.ToLower(spec.CNAME), ".")
+		var failure error = fmt.Errorf("cname %s not found", spec.CNAME)
+		for _, answer := range answers {
+			if cname, ok := answer.Body.(*dnsmessage.CNAMEResource); ok && strings.TrimSuffix(strings.ToLower(cname.CNAME.String()), ".") == expected {
+				failure = nil
+				break
+			}
+		}
+		record("cname "+spec.CNAME, failure)
+	}
+
+	if spec.MinTTL.Duration > 0 {
+		var failure error
+		for _, answer := range answers {
+			if ttl := time.Duration(answer.Header.TTL) * time.Second; ttl < spec.MinTTL.Duration {
+				failure = fmt.Errorf("TTL %s of %s record is lower than %s", ttl, typeName(answer.Header.Type), spec.MinTTL.Duration)
+				break
+			}
+		}
+		record("min_ttl "+spec.MinTTL.Duration.String(), failure)
+	}
+	return
+}
+
+// resolve sends the query to the resolver over UDP. If the response is truncated, the query is repeated over TCP.
+func resolve(ctx context.Context, query dnsQuery) (response *dnsmessage.Message, err error) {
+	request := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: uint16(rand.Uint32()), RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  query.name,
+			Type:  query.queryType,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	packed, err := request.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	if response, err = exchangeDNS(ctx, "udp", query.resolver, packed, request.ID); err == nil && response.Truncated {
+		response, err = exchangeDNS(ctx, "tcp", query.resolver, packed, request.ID)
+	}
+	return
+}
+
+// exchangeDNS sends a packed DNS request to the resolver and returns the resolver's response. TCP messages are
+// prefixed with their length.
+func exchangeDNS(ctx context.Context, network, resolver string, request []byte, id uint16) (*dnsmessage.Message, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, dialNetwork(ctx, network), dialAddress(ctx, resolver))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if network == "tcp" {
+		request = append([]byte{byte(len(request) >> 8), byte(len(request))}, request...)
+	}
+	if _, err = conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	for {
+		var buf []byte
+		if buf, err = readDNSMessage(conn, network); err != nil {
+			return nil, err
+		}
+		var response dnsmessage.Message
+		if err = response.Unpack(buf); err != nil {
+			return nil, fmt.Errorf("invalid response: %w", err)
+		}
+		// ignore stray UDP responses to earlier queries
+		if response.ID == id && response.Response {
+			return &response, nil
+		}
+		if network == "tcp" {
+			return nil, errors.New("invalid response: ID mismatch")
+		}
+	}
+}
+
+func readDNSMessage(conn net.Conn, network string) ([]byte, error) {
+	if network == "udp" {
+		buf := make([]byte, maxDNSMessageSize)
+		n, err := conn.Read(buf)
+		return buf[:n], err
+	}
+	var size uint16
+	if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	_, err := io.ReadFull(conn, buf)
+	return buf, err
+}
+
+// recordValue returns a description of the record's value, e.g. an IP address for an A record
+func recordValue(body dnsmessage.ResourceBody) string {
+	switch record := body.(type) {
+	case *dnsmessage.AResource:
+		return net.IP(record.A[:]).String()
+	case *dnsmessage.AAAAResource:
+		return net.IP(record.AAAA[:]).String()
+	case *dnsmessage.CNAMEResource:
+		return record.CNAME.String()
+	case *dnsmessage.MXResource:
+		return strconv.Itoa(int(record.Pref)) + " " + record.MX.String()
+	case *dnsmessage.NSResource:
+		return record.NS.String()
+	case *dnsmessage.TXTResource:
+		return strings.Join(record.TXT, "")
+	case *dnsmessage.SOAResource:
+		return record.NS.String() + " " + record.MBox.String() + " " + strconv.FormatUint(uint64(record.Serial), 10)
+	default:
+		return ""
+	}
+}
+
+// recordAddress returns the IP address of an A or AAAA record, or nil for other records
+func recordAddress(body dnsmessage.ResourceBody) net.IP {
+	switch record := body.(type) {
+	case *dnsmessage.AResource:
+		return record.A[:]
+	case *dnsmessage.AAAAResource:
+		return record.AAAA[:]
+	default:
+		return nil
+	}
+}
+
+// typeName returns the name of a record type, e.g. "A"
+func typeName(recordType dnsmessage.Type) string {
+	for name, t := range dnsTypes {
+		if t == recordType {
+			return name
+		}
+	}
+	return recordType.String()
+}
+
+// rCodeName returns the conventional name of a response code, e.g. "NXDOMAIN"
+func rCodeName(rCode dnsmessage.RCode) string {
+	if name, ok := rCodes[rCode]; ok {
+		return name
+	}
+	return rCode.String()
+}
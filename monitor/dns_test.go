@@ -0,0 +1,276 @@
+package monitor_test
+
+import (
+	"context"
+	"encoding/binary"
+	"github.com/clambin/webmon/monitor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMonitor_CheckSites_DNS(t *testing.T) {
+	records := []dnsmessage.Resource{
+		aRecord("example.com.", "192.0.2.1", 300),
+		aRecord("example.com.", "192.0.2.2", 300),
+		cnameRecord("www.example.com.", "example.com.", 3600),
+		aRecord("www.example.com.", "192.0.2.1", 60),
+	}
+	// more records than fit in a UDP response
+	for _, text := range []string{"v=spf1 -all", "a", "b", "c", "d"} {
+		records = append(records, txtRecord("txt.example.com.", text, 60))
+	}
+	server := newDNSServer(t, records...)
+	defer server.close()
+
+	testCases := []struct {
+		name       string
+		url        string
+		dns        *monitor.DNSSpec
+		up         bool
+		lastError  string
+		dnsError   string
+		rCode      string
+		answers    []string
+		assertions map[string]bool
+	}{
+		{
+			name:       "addresses",
+			url:        "/example.com?type=A",
+			dns:        &monitor.DNSSpec{Addresses: []string{"192.0.2.1", "192.0.2.2"}},
+			up:         true,
+			rCode:      "NOERROR",
+			answers:    []string{"A 192.0.2.1", "A 192.0.2.2"},
+			assertions: map[string]bool{"address 192.0.2.1": true, "address 192.0.2.2": true},
+		},
+		{
+			name:       "addresses - fail",
+			url:        "/example.com",
+			dns:        &monitor.DNSSpec{Addresses: []string{"192.0.2.3"}},
+			lastError:  "address 192.0.2.3 not found",
+			rCode:      "NOERROR",
+			answers:    []string{"A 192.0.2.1", "A 192.0.2.2"},
+			assertions: map[string]bool{"address 192.0.2.3": false},
+		},
+		{
+			name:       "cname",
+			url:        "/www.example.com",
+			dns:        &monitor.DNSSpec{CNAME: "Example.com"},
+			up:         true,
+			rCode:      "NOERROR",
+			answers:    []string{"CNAME example.com.", "A 192.0.2.1"},
+			assertions: map[string]bool{"cname Example.com": true},
+		},
+		{
+			name:       "min ttl",
+			url:        "/www.example.com",
+			dns:        &monitor.DNSSpec{MinTTL: monitor.Duration{Duration: 5 * time.Minute}},
+			lastError:  "TTL 1m0s of A record is lower than 5m0s",
+			rCode:      "NOERROR",
+			answers:    []string{"CNAME example.com.", "A 192.0.2.1"},
+			assertions: map[string]bool{"min_ttl 5m0s": false},
+		},
+		{
+			name:       "nxdomain",
+			url:        "/missing.example.com",
+			dns:        &monitor.DNSSpec{NXDomain: true},
+			up:         true,
+			rCode:      "NXDOMAIN",
+			assertions: map[string]bool{"nxdomain": true},
+		},
+		{
+			name:       "nxdomain - fail",
+			url:        "/example.com",
+			dns:        &monitor.DNSSpec{NXDomain: true},
+			lastError:  "expected NXDOMAIN, got NOERROR",
+			rCode:      "NOERROR",
+			assertions: map[string]bool{"nxdomain": false},
+		},
+		{
+			name:      "not found",
+			url:       "/missing.example.com",
+			lastError: "dns: NXDOMAIN",
+			dnsError:  "NXDOMAIN",
+			rCode:     "NXDOMAIN",
+		},
+		{
+			name:      "server failure",
+			url:       "/servfail.example.com",
+			lastError: "dns: SERVFAIL",
+			dnsError:  "SERVFAIL",
+			rCode:     "SERVFAIL",
+		},
+		{
+			name:      "no records",
+			url:       "/example.com?type=AAAA",
+			lastError: "dns: no AAAA records found",
+			dnsError:  "no AAAA records found",
+			rCode:     "NOERROR",
+			answers:   []string{},
+		},
+		{
+			name:    "truncated",
+			url:     "/txt.example.com?type=txt",
+			up:      true,
+			rCode:   "NOERROR",
+			answers: []string{"TXT v=spf1 -all", "TXT a", "TXT b", "TXT c", "TXT d"},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			url := "dns://" + server.address() + tt.url
+			m := newMonitor(t, monitor.SiteSpec{URL: url, DNS: tt.dns, Timeout: monitor.Duration{Duration: time.Second}})
+			m.CheckSites(context.Background())
+
+			entry, ok := m.GetEntry(url)
+			require.True(t, ok)
+			require.NotNil(t, entry.State)
+			assert.Equal(t, tt.up, entry.State.Up)
+			assert.Equal(t, tt.lastError, entry.State.LastError)
+			assert.Equal(t, tt.dnsError, entry.State.DNSError)
+			assert.Equal(t, tt.rCode, entry.State.DNSResponseCode)
+			assert.Equal(t, tt.answers, entry.State.DNSAnswers)
+			assert.Equal(t, tt.assertions, entry.State.Assertions)
+			assert.NotZero(t, entry.State.Latency.Duration)
+		})
+	}
+}
+
+func TestMonitor_CheckSites_DNS_Unreachable(t *testing.T) {
+	server := newDNSServer(t)
+	url := "dns://" + server.address() + "/example.com"
+	server.close()
+
+	m := newMonitor(t, monitor.SiteSpec{URL: url, Timeout: monitor.Duration{Duration: 100 * time.Millisecond}})
+	m.CheckSites(context.Background())
+
+	entry, ok := m.GetEntry(url)
+	require.True(t, ok)
+	require.NotNil(t, entry.State)
+	assert.False(t, entry.State.Up)
+	assert.NotEmpty(t, entry.State.DNSError)
+	assert.Equal(t, "dns: "+entry.State.DNSError, entry.State.LastError)
+	assert.Empty(t, entry.State.DNSResponseCode)
+}
+
+// dnsServer is a local DNS server stand-in. It answers queries for its records over UDP and TCP. UDP responses with
+// more than maxUDPAnswers answers are truncated. Queries for servfail.example.com fail with SERVFAIL.
+type dnsServer struct {
+	udp     net.PacketConn
+	tcp     net.Listener
+	records []dnsmessage.Resource
+}
+
+const maxUDPAnswers = 4
+
+func newDNSServer(t *testing.T, records ...dnsmessage.Resource) *dnsServer {
+	t.Helper()
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	require.NoError(t, err)
+	server := &dnsServer{udp: udp, tcp: tcp, records: records}
+	go server.serveUDP()
+	go server.serveTCP()
+	return server
+}
+
+func (server *dnsServer) address() string {
+	return server.udp.LocalAddr().String()
+}
+
+func (server *dnsServer) close() {
+	_ = server.udp.Close()
+	_ = server.tcp.Close()
+}
+
+func (server *dnsServer) serveUDP() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := server.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if response, err := server.answer(buf[:n], true); err == nil {
+			_, _ = server.udp.WriteTo(response, addr)
+		}
+	}
+}
+
+func (server *dnsServer) serveTCP() {
+	for {
+		conn, err := server.tcp.Accept()
+		if err != nil {
+			return
+		}
+		var size uint16
+		if binary.Read(conn, binary.BigEndian, &size) == nil {
+			request := make([]byte, size)
+			if _, err = io.ReadFull(conn, request); err == nil {
+				if response, err := server.answer(request, false); err == nil {
+					_, _ = conn.Write(append([]byte{byte(len(response) >> 8), byte(len(response))}, response...))
+				}
+			}
+		}
+		_ = conn.Close()
+	}
+}
+
+func (server *dnsServer) answer(request []byte, udp bool) ([]byte, error) {
+	var query dnsmessage.Message
+	if err := query.Unpack(request); err != nil {
+		return nil, err
+	}
+	response := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: query.ID, Response: true, RecursionDesired: query.RecursionDesired, RCode: dnsmessage.RCodeNameError},
+		Questions: query.Questions,
+	}
+	question := query.Questions[0]
+	if question.Name.String() == "servfail.example.com." {
+		response.RCode = dnsmessage.RCodeServerFailure
+		return response.Pack()
+	}
+	for _, record := range server.records {
+		if record.Header.Name != question.Name {
+			continue
+		}
+		response.RCode = dnsmessage.RCodeSuccess
+		if record.Header.Type == question.Type || record.Header.Type == dnsmessage.TypeCNAME {
+			response.Answers = append(response.Answers, record)
+		}
+	}
+	if udp && len(response.Answers) > maxUDPAnswers {
+		response.Truncated = true
+		response.Answers = nil
+	}
+	return response.Pack()
+}
+
+func aRecord(name, address string, ttl uint32) dnsmessage.Resource {
+	var a [4]byte
+	copy(a[:], net.ParseIP(address).To4())
+	return dnsmessage.Resource{Header: recordHeader(name, dnsmessage.TypeA, ttl), Body: &dnsmessage.AResource{A: a}}
+}
+
+func aaaaRecord(name, address string, ttl uint32) dnsmessage.Resource {
+	var aaaa [16]byte
+	copy(aaaa[:], net.ParseIP(address).To16())
+	return dnsmessage.Resource{Header: recordHeader(name, dnsmessage.TypeAAAA, ttl), Body: &dnsmessage.AAAAResource{AAAA: aaaa}}
+}
+
+func cnameRecord(name, cname string, ttl uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{Header: recordHeader(name, dnsmessage.TypeCNAME, ttl), Body: &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName(cname)}}
+}
+
+func txtRecord(name, text string, ttl uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{Header: recordHeader(name, dnsmessage.TypeTXT, ttl), Body: &dnsmessage.TXTResource{TXT: []string{text}}}
+}
+
+func recordHeader(name string, recordType dnsmessage.Type, ttl uint32) dnsmessage.ResourceHeader {
+	return dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: recordType, Class: dnsmessage.ClassINET, TTL: ttl}
+}
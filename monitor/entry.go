@@ -15,10 +15,65 @@ type Entry struct {
 
 // A SiteSpec to monitor
 type SiteSpec struct {
-	// URL of the site
+	// URL of the site. Supported schemes are http, https, tcp (e.g. tcp://db.example.com:5432), tls, the STARTTLS
+	// schemes smtp+starttls, imap+starttls, ldap+starttls and postgres+starttls, dns (e.g.
+	// dns://8.8.8.8/example.com?type=AAAA, which resolves example.com's AAAA records using 8.8.8.8), grpc, grpcs, ws
+	// and wss
 	URL string `json:"url"`
 	// Name of the site
 	Name string `json:"name,omitempty"`
+	// Interval specifies how often the site is checked. If zero, the interval passed to Monitor.Run is used
+	Interval Duration `json:"interval,omitempty"`
+	// Timeout specifies how long a check may take. Default: DefaultTimeout
+	Timeout Duration `json:"timeout,omitempty"`
+	// Method is the HTTP method used to check the site. Default: GET
+	Method string `json:"method,omitempty"`
+	// Headers lists the HTTP headers added to the request. See Header
+	Headers []Header `json:"headers,omitempty"`
+	// Body is sent as the request body
+	Body string `json:"body,omitempty"`
+	// StatusCodes lists the HTTP status codes & ranges that indicate the site is up, e.g. "200-299,401".
+	// If blank, DefaultStatusCodes is used
+	StatusCodes string `json:"status_codes,omitempty"`
+	// Content specifies the assertions on the site's response body. See ContentSpec
+	Content *ContentSpec `json:"content,omitempty"`
+	// JSON lists the assertions on the site's JSON response body. See JSONAssertion
+	JSON []JSONAssertion `json:"json,omitempty"`
+	// DNS contains the assertions on the answer of a DNS site. See DNSSpec
+	DNS *DNSSpec `json:"dns,omitempty"`
+	// GRPC specifies how a gRPC site is checked. See GRPCSpec
+	GRPC *GRPCSpec `json:"grpc,omitempty"`
+	// TCP specifies how a TCP site (tcp://host:port) is checked. See TCPSpec
+	TCP *TCPSpec `json:"tcp,omitempty"`
+	// WebSocket specifies how a WebSocket site is checked. See WebSocketSpec
+	WebSocket *WebSocketSpec `json:"websocket,omitempty"`
+	// TLS specifies how the site's TLS connection is set up and checked. See TLSSpec
+	TLS *TLSSpec `json:"tls,omitempty"`
+	// Proxy specifies the proxy used to connect to the site. Default: the proxy configured in the environment (HTTP and
+	// HTTPS sites only). See ProxySpec
+	Proxy *ProxySpec `json:"proxy,omitempty"`
+	// ResolveTo is the IP address that the site's hostname resolves to, instead of the addresses in DNS (like curl's
+	// --resolve option). The Host header and TLS SNI still use the site's hostname and the site's certificate is
+	// verified against the hostname
+	ResolveTo string `json:"resolve_to,omitempty"`
+	// AllAddresses checks the site at each IP address (A and AAAA record) of its hostname, rather than at the address
+	// picked by the dialer. Each address is checked with the site's original hostname (Host header and TLS SNI)
+	AllAddresses bool `json:"all_addresses,omitempty"`
+	// Quorum is the number of addresses that must be up for the site to be up, if AllAddresses is set. If the hostname
+	// has fewer addresses, the site is reported as down. Default: all addresses
+	Quorum int `json:"quorum,omitempty"`
+	// IPFamily forces the IP family used to connect to the site: IPFamilyV4 or IPFamilyV6. IPFamilyBoth checks the site
+	// over both IP families: the site is only up if it is up over both. Default: either family, as picked by the dialer
+	IPFamily string `json:"ip_family,omitempty"`
+	// Retries is the number of times a failed check is retried before the check is considered to have failed
+	Retries int `json:"retries,omitempty"`
+	// RetryBackoff is the time to wait before the first retry. It doubles after each retry, up to MaxRetryBackoff.
+	// Retries only start within the site's interval. Default: DefaultRetryBackoff
+	RetryBackoff Duration `json:"retry_backoff,omitempty"`
+	// FailureThreshold is the number of consecutive failed checks before an up site is reported as down. Default: 1
+	FailureThreshold int `json:"failure_threshold,omitempty"`
+	// SuccessThreshold is the number of consecutive successful checks before a down site is reported as up. Default: 1
+	SuccessThreshold int `json:"success_threshold,omitempty"`
 }
 
 // The SiteState structure holds the attributes that will be checked
@@ -27,15 +82,86 @@ type SiteState struct {
 	Up bool `json:"up"`
 	// LastError is the last error received when checking the site
 	LastError string `json:"last_error,omitempty"`
+	// MaskedError is the error received when checking the site, if the site's FailureThreshold hasn't been reached yet.
+	// The site is still reported as up, but its latency, certificate & timing metrics aren't
+	MaskedError string `json:"masked_error,omitempty"`
+	// ProxyError contains the reason why the connection to the site couldn't be tunnelled through (or the request
+	// forwarded by) the site's proxy
+	ProxyError string `json:"proxy_error,omitempty"`
 	// HTTPCode is the last HTTP Code received when checking the site
 	HTTPCode int `json:"http_code,omitempty"`
 	// CertificateAge contains the number of days that the site's TLS certificate is still valid
 	// IsTLS indicates the site is using encryption (i.e. TLS)
 	IsTLS bool `json:"is_tls"`
-	// For HTTP sites, this will be zero.
+	// For HTTP sites, this will be zero. If the site presents a certificate chain, this is the number of days
+	// before the first certificate in the chain expires.
 	CertificateAge float64 `json:"certificate_age,omitempty"`
-	// Latency contains the time it took to check the site
+	// Certificates lists the certificate chain presented by the site. See Certificate
+	Certificates []Certificate `json:"certificates,omitempty"`
+	// Fingerprint is the SHA-256 fingerprint of the site's (leaf) certificate. If the last check didn't return
+	// a certificate, this is the last known fingerprint
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// Issuer is the issuer of the site's (leaf) certificate. If the last check didn't return a certificate,
+	// this is the last known issuer
+	Issuer string `json:"issuer,omitempty"`
+	// CertificateChanges counts how often the site's certificate changed
+	CertificateChanges int `json:"certificate_changes,omitempty"`
+	// IssuerChanges counts how often the issuer of the site's certificate changed
+	IssuerChanges int `json:"issuer_changes,omitempty"`
+	// TLSVersion is the negotiated TLS version, e.g. "1.3"
+	TLSVersion string `json:"tls_version,omitempty"`
+	// CipherSuite is the negotiated cipher suite, e.g. "TLS_AES_128_GCM_SHA256"
+	CipherSuite string `json:"cipher_suite,omitempty"`
+	// KeyType is the type of the site certificate's public key: "RSA", "ECDSA" or "Ed25519"
+	KeyType string `json:"key_type,omitempty"`
+	// KeySize is the size of the site certificate's public key, in bits
+	KeySize int `json:"key_size,omitempty"`
+	// SignatureAlgorithm is the algorithm used to sign the site's certificate, e.g. "SHA256-RSA"
+	SignatureAlgorithm string `json:"signature_algorithm,omitempty"`
+	// Revocation is the revocation status of the site's certificate: RevocationGood, RevocationRevoked or
+	// RevocationUnknown. Blank if the site's certificate wasn't checked for revocation
+	Revocation string `json:"revocation,omitempty"`
+	// RevocationSource is where the revocation status was obtained: RevocationSourceStapled, RevocationSourceOCSP
+	// or RevocationSourceCRL
+	RevocationSource string `json:"revocation_source,omitempty"`
+	// RevocationError contains the reason why the revocation status is unknown
+	RevocationError string `json:"revocation_error,omitempty"`
+	// TLSVerification contains the result of verifying the site's certificate: TLSVerificationOK, or the reason
+	// why verification failed (e.g. TLSVerificationExpired). Blank if the site's certificate wasn't verified
+	TLSVerification string `json:"tls_verification,omitempty"`
+	// TLSVerificationError contains the error returned when verifying the site's certificate
+	TLSVerificationError string `json:"tls_verification_error,omitempty"`
+	// DNSResponseCode is the response code returned by a DNS site's resolver, e.g. "NOERROR" or "NXDOMAIN"
+	DNSResponseCode string `json:"dns_response_code,omitempty"`
+	// DNSError contains the reason why a DNS site's query failed, e.g. a timeout, a response code like "SERVFAIL",
+	// or an answer without records of the requested type. Failed assertions are reported in Assertions
+	DNSError string `json:"dns_error,omitempty"`
+	// DNSAnswers lists the records in the answer of a DNS site's resolver, e.g. "A 192.0.2.1"
+	DNSAnswers []string `json:"dns_answers,omitempty"`
+	// GRPCStatus is the serving status reported by a gRPC site's health service, e.g. "SERVING" or "NOT_SERVING"
+	GRPCStatus string `json:"grpc_status,omitempty"`
+	// Assertions contains the result of each of the site's JSON or DNS assertions, keyed by the assertion's description
+	Assertions map[string]bool `json:"assertions,omitempty"`
+	// Latency contains the time it took to check the site, including reading the response body
 	Latency Duration `json:"latency,omitempty"`
+	// RoundTrip is the time between sending a WebSocket site's message and receiving the expected reply
+	RoundTrip *Duration `json:"round_trip,omitempty"`
+	// Addresses contains the result of checking each of the site's IP addresses, if the site's AllAddresses is set.
+	// The other attributes describe the first address that is up, or the first address if none are up
+	Addresses []AddressState `json:"addresses,omitempty"`
+	// Families contains the result of checking the site over each IP family, if the site's IPFamily is IPFamilyBoth
+	Families []FamilyState `json:"families,omitempty"`
+	// Timings contains the duration of each phase of the check. See Timings
+	Timings *Timings `json:"timings,omitempty"`
+	// ConnectionReused indicates that the check reused an existing connection. If so, the DNS, Connect and TLS
+	// timings are zero
+	ConnectionReused bool `json:"connection_reused,omitempty"`
+	// Attempts is the number of attempts made during the last check, including any retries
+	Attempts int `json:"attempts,omitempty"`
+	// FailureStreak is the number of consecutive failed checks. A site that is up with a non-zero FailureStreak is degrading
+	FailureStreak int `json:"failure_streak,omitempty"`
+	// SuccessStreak is the number of consecutive successful checks
+	SuccessStreak int `json:"success_streak,omitempty"`
 	// LastCheck is the timestamp the site was last checked. Before there first check, this is zero
 	LastCheck time.Time `json:"last_check,omitempty"`
 }
@@ -0,0 +1,143 @@
+package monitor
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// A GRPCSpec specifies how a gRPC site (grpc://host:port or grpcs://host:port) is checked. The site must implement
+// the gRPC health checking protocol (grpc.health.v1.Health). The site is up if its health service reports SERVING.
+type GRPCSpec struct {
+	// Service is the name of the service whose health is checked. If blank, the server's overall health is checked
+	Service string `json:"service,omitempty"`
+}
+
+func (spec *GRPCSpec) service() string {
+	if spec == nil {
+		return ""
+	}
+	return spec.Service
+}
+
+// checkGRPC checks a gRPC site, using the gRPC health checking protocol. For grpcs sites, the site's TLS connection
+// is inspected like an HTTPS site's. The site's latency is the time it took to set up the connection and call the
+// health service.
+func (monitor *Monitor) checkGRPC(ctx context.Context, site SiteSpec) (state *SiteState) {
+	state = &SiteState{}
+	target, err := url.Parse(site.URL)
+	if err != nil {
+		state.LastError = err.Error()
+		return
+	}
+
+	dialer := &grpcDialer{site: site, network: dialNetwork(ctx, "tcp")}
+	if target.Scheme == "grpcs" {
+		if dialer.tlsConfig, err = monitor.siteTLSConfig(site); err != nil {
+			state.LastError = "invalid TLS configuration: " + err.Error()
+			return
+		}
+		if dialer.tlsConfig.ServerName == "" {
+			dialer.tlsConfig.ServerName = target.Hostname()
+		}
+		dialer.tlsConfig.NextProtos = []string{"h2"}
+	}
+
+	start := time.Now()
+	// the dialer sets up the TLS connection, so the TLS connection can be inspected and TLS errors can be reported.
+	// gRPC doesn't pass the check's context to the dialer, so a pinned address and IP family are passed explicitly.
+	conn, err := grpc.DialContext(ctx, dialAddress(ctx, target.Host),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(dialer.dial),
+		grpc.WithAuthority(target.Host),
+	)
+	if err != nil {
+		state.LastError = err.Error()
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	response, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: site.GRPC.service()})
+	state.Latency = Duration{Duration: time.Since(start)}
+
+	connection, connectErr := dialer.result()
+	if connectErr != nil {
+		state.setConnectionError(connectErr)
+		return
+	}
+	if err != nil {
+		state.LastError = err.Error()
+		return
+	}
+
+	state.GRPCStatus = response.GetStatus().String()
+	if state.Up = response.GetStatus() == grpc_health_v1.HealthCheckResponse_SERVING; state.Up == false {
+		state.LastError = fmt.Sprintf("service status is %s", state.GRPCStatus)
+	}
+
+	if connection != nil {
+		monitor.inspectTLS(ctx, site, connection, dialer.tlsConfig, target.Hostname(), state)
+	}
+	return
+}
+
+// grpcDialer sets up the connection to a gRPC site, through the site's proxy if one is configured. If tlsConfig is set,
+// it performs the TLS handshake. It records the result, so proxy and TLS errors can be reported
+type grpcDialer struct {
+	site       SiteSpec
+	network    string
+	tlsConfig  *tls.Config
+	connection *tls.ConnectionState
+	connectErr error
+	lock       sync.Mutex
+}
+
+func (dialer *grpcDialer) dial(ctx context.Context, address string) (conn net.Conn, err error) {
+	if dialer.site.Proxy.enabled() {
+		conn, err = dialer.site.Proxy.dial(ctx, address)
+	} else {
+		var netDialer net.Dialer
+		conn, err = netDialer.DialContext(ctx, dialer.network, address)
+	}
+	if err != nil {
+		var proxyErr *proxyError
+		if errors.As(err, &proxyErr) {
+			dialer.setResult(nil, err)
+		}
+		return nil, err
+	}
+	if dialer.tlsConfig == nil {
+		return conn, nil
+	}
+
+	tlsConn := tls.Client(conn, dialer.tlsConfig)
+	if err = tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		dialer.setResult(nil, err)
+		return nil, err
+	}
+	connection := tlsConn.ConnectionState()
+	dialer.setResult(&connection, nil)
+	return tlsConn, nil
+}
+
+func (dialer *grpcDialer) setResult(connection *tls.ConnectionState, err error) {
+	dialer.lock.Lock()
+	defer dialer.lock.Unlock()
+	dialer.connection, dialer.connectErr = connection, err
+}
+
+// result returns the state of the TLS connection, or the error returned by the proxy or the TLS handshake
+func (dialer *grpcDialer) result() (*tls.ConnectionState, error) {
+	dialer.lock.Lock()
+	defer dialer.lock.Unlock()
+	return dialer.connection, dialer.connectErr
+}
@@ -0,0 +1,133 @@
+package monitor_test
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/clambin/webmon/monitor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMonitor_CheckSites_GRPC(t *testing.T) {
+	address := newGRPCServer(t, nil)
+
+	testCases := []struct {
+		name      string
+		grpc      *monitor.GRPCSpec
+		up        bool
+		status    string
+		lastError string
+	}{
+		{name: "server", up: true, status: "SERVING"},
+		{name: "service", grpc: &monitor.GRPCSpec{Service: "webmon.Serving"}, up: true, status: "SERVING"},
+		{name: "not serving", grpc: &monitor.GRPCSpec{Service: "webmon.NotServing"}, status: "NOT_SERVING", lastError: "service status is NOT_SERVING"},
+		{name: "unknown service", grpc: &monitor.GRPCSpec{Service: "webmon.Unknown"}, lastError: "rpc error: code = NotFound desc = unknown service"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			url := "grpc://" + address
+			m := newMonitor(t, monitor.SiteSpec{URL: url, GRPC: tt.grpc, Timeout: monitor.Duration{Duration: time.Second}})
+			m.CheckSites(context.Background())
+
+			entry, ok := m.GetEntry(url)
+			require.True(t, ok)
+			require.NotNil(t, entry.State)
+			assert.Equal(t, tt.up, entry.State.Up)
+			assert.Equal(t, tt.status, entry.State.GRPCStatus)
+			assert.Equal(t, tt.lastError, entry.State.LastError)
+			assert.False(t, entry.State.IsTLS)
+			assert.NotZero(t, entry.State.Latency.Duration)
+		})
+	}
+}
+
+func TestMonitor_CheckSites_GRPCS(t *testing.T) {
+	root := newTestCA(t, "root", nil, 10*365*24*time.Hour)
+	certificate := root.issue(t, 30*24*time.Hour, "localhost", "127.0.0.1")
+	address := newGRPCServer(t, &certificate)
+
+	testCases := []struct {
+		name         string
+		client       *tls.Config
+		tls          *monitor.TLSSpec
+		up           bool
+		lastError    string
+		verification string
+	}{
+		{name: "valid", client: &tls.Config{RootCAs: root.pool()}, up: true, verification: monitor.TLSVerificationOK},
+		{name: "site ca", tls: &monitor.TLSSpec{CA: root.pem()}, up: true, verification: monitor.TLSVerificationOK},
+		{name: "unknown authority", lastError: "x509: certificate signed by unknown authority", verification: monitor.TLSVerificationUnknownAuthority},
+		{name: "deferred", tls: &monitor.TLSSpec{DeferVerification: true}, up: true, verification: monitor.TLSVerificationUnknownAuthority},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			url := "grpcs://" + address
+			m := newMonitor(t, monitor.SiteSpec{URL: url, TLS: tt.tls, Timeout: monitor.Duration{Duration: time.Second}})
+			m.HTTPClient = &http.Client{Transport: &http.Transport{TLSClientConfig: tt.client}}
+			m.CheckSites(context.Background())
+
+			entry, ok := m.GetEntry(url)
+			require.True(t, ok)
+			require.NotNil(t, entry.State)
+			assert.Equal(t, tt.up, entry.State.Up)
+			assert.Contains(t, entry.State.LastError, tt.lastError)
+			assert.Equal(t, tt.verification, entry.State.TLSVerification)
+			assert.Equal(t, tt.up, entry.State.IsTLS)
+			if tt.up {
+				assert.Equal(t, "SERVING", entry.State.GRPCStatus)
+				require.Len(t, entry.State.Certificates, 1)
+				assert.Equal(t, "CN=localhost", entry.State.Certificates[0].Subject)
+				assert.InDelta(t, 30, entry.State.CertificateAge, 1)
+			}
+		})
+	}
+}
+
+func TestMonitor_CheckSites_GRPC_Unavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	url := "grpc://" + listener.Addr().String()
+	_ = listener.Close()
+
+	m := newMonitor(t, monitor.SiteSpec{URL: url, Timeout: monitor.Duration{Duration: time.Second}})
+	m.CheckSites(context.Background())
+
+	entry, ok := m.GetEntry(url)
+	require.True(t, ok)
+	require.NotNil(t, entry.State)
+	assert.False(t, entry.State.Up)
+	assert.Contains(t, entry.State.LastError, "code = Unavailable")
+	assert.Empty(t, entry.State.GRPCStatus)
+}
+
+// newGRPCServer starts a gRPC server that implements the health service. The server's overall status and the status
+// of webmon.Serving are SERVING. The status of webmon.NotServing is NOT_SERVING. If certificate is set, the server uses TLS.
+func newGRPCServer(t *testing.T, certificate *tls.Certificate) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var options []grpc.ServerOption
+	if certificate != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{*certificate}})))
+	}
+	server := grpc.NewServer(options...)
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("webmon.Serving", grpc_health_v1.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus("webmon.NotServing", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	grpc_health_v1.RegisterHealthServer(server, healthServer)
+
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+	return listener.Addr().String()
+}
@@ -0,0 +1,122 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// IP families that a site can be checked over. See SiteSpec.IPFamily
+const (
+	IPFamilyV4   = "v4"
+	IPFamilyV6   = "v6"
+	IPFamilyBoth = "both"
+)
+
+// FamilyState contains the result of checking a site over one IP family. See SiteSpec.IPFamily
+type FamilyState struct {
+	// Family is the IP family that was checked: IPFamilyV4 or IPFamilyV6
+	Family string `json:"family"`
+	// Up indicates if the site was up over this IP family
+	Up bool `json:"up"`
+	// LastError contains the reason why the site was down over this IP family
+	LastError string `json:"last_error,omitempty"`
+	// Latency contains the time it took to check the site over this IP family
+	Latency Duration `json:"latency"`
+}
+
+func validateIPFamily(family string) error {
+	switch family {
+	case "", IPFamilyV4, IPFamilyV6, IPFamilyBoth:
+		return nil
+	default:
+		return fmt.Errorf("invalid ip_family '%s'", family)
+	}
+}
+
+type ipFamilyKey struct{}
+
+// withIPFamily returns a context that forces connections to use the specified IP family
+func withIPFamily(ctx context.Context, family string) context.Context {
+	if family != IPFamilyV4 && family != IPFamilyV6 {
+		return ctx
+	}
+	return context.WithValue(ctx, ipFamilyKey{}, family)
+}
+
+// dialNetwork returns the network to connect over. If the context forces an IP family, "tcp" and "udp" are restricted
+// to that family (e.g. "tcp4"), so the dialer doesn't silently fall back to the other family.
+func dialNetwork(ctx context.Context, network string) string {
+	family, _ := ctx.Value(ipFamilyKey{}).(string)
+	if network != "tcp" && network != "udp" {
+		return network
+	}
+	switch family {
+	case IPFamilyV4:
+		return network + "4"
+	case IPFamilyV6:
+		return network + "6"
+	default:
+		return network
+	}
+}
+
+// lookupNetwork returns the network used to look up a site's IP addresses: "ip", or "ip4"/"ip6" if the context forces
+// an IP family
+func lookupNetwork(ctx context.Context) string {
+	switch dialNetwork(ctx, "tcp") {
+	case "tcp4":
+		return "ip4"
+	case "tcp6":
+		return "ip6"
+	default:
+		return "ip"
+	}
+}
+
+// checkFamilies checks the site over IPv4 and over IPv6. The site is up if it is up over both IP families. The site's
+// state is the state of the first IP family that is up (or IPv4 if neither is up), with the result of each IP family
+// reported in Families.
+func (monitor *Monitor) checkFamilies(ctx context.Context, site SiteSpec, hostname string, check checker) (state *SiteState) {
+	families := []string{IPFamilyV4, IPFamilyV6}
+	states := make([]*SiteState, len(families))
+	var wg sync.WaitGroup
+	wg.Add(len(families))
+	for index, family := range families {
+		go func(index int, family string) {
+			states[index] = monitor.checkHost(withIPFamily(ctx, family), site, hostname, check)
+			wg.Done()
+		}(index, family)
+	}
+	wg.Wait()
+
+	var addresses []AddressState
+	results := make([]FamilyState, 0, len(families))
+	for index, familyState := range states {
+		results = append(results, FamilyState{
+			Family:    families[index],
+			Up:        familyState.Up,
+			LastError: familyState.LastError,
+			Latency:   familyState.Latency,
+		})
+		addresses = append(addresses, familyState.Addresses...)
+		if familyState.Up && state == nil {
+			state = familyState
+		}
+	}
+	if state == nil {
+		state = states[0]
+	}
+	state.Families = results
+	state.Addresses = addresses
+
+	state.Up = true
+	for _, result := range results {
+		if result.Up == false {
+			state.Up = false
+			state.LastError = fmt.Sprintf("%s: %s", result.Family, result.LastError)
+			break
+		}
+	}
+	return
+}
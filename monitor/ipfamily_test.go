@@ -0,0 +1,119 @@
+package monitor_test
+
+import (
+	"context"
+	"github.com/clambin/gotools/metrics"
+	"github.com/clambin/webmon/monitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMonitor_CheckSites_IPFamily(t *testing.T) {
+	port := newAddressServers(t, nil, "127.0.0.1")
+
+	testCases := []struct {
+		name      string
+		family    string
+		up        bool
+		lastError string
+		families  []monitor.FamilyState
+	}{
+		{name: "default", up: true},
+		{name: "v4", family: monitor.IPFamilyV4, up: true},
+		{name: "v6", family: monitor.IPFamilyV6, lastError: "no suitable address"},
+		{name: "both", family: monitor.IPFamilyBoth, lastError: "v6: ", families: []monitor.FamilyState{{Family: "v4", Up: true}, {Family: "v6"}}},
+	}
+
+	for _, scheme := range []string{"http", "tcp"} {
+		for _, tt := range testCases {
+			t.Run(scheme+"-"+tt.name, func(t *testing.T) {
+				url := scheme + "://127.0.0.1:" + port
+				m := newMonitor(t, monitor.SiteSpec{URL: url, IPFamily: tt.family, Timeout: monitor.Duration{Duration: time.Second}})
+				m.CheckSites(context.Background())
+
+				entry, ok := m.GetEntry(url)
+				require.True(t, ok)
+				require.NotNil(t, entry.State)
+				assert.Equal(t, tt.up, entry.State.Up)
+				assert.Contains(t, entry.State.LastError, tt.lastError)
+				require.Len(t, entry.State.Families, len(tt.families))
+				for index, family := range tt.families {
+					assert.Equal(t, family.Family, entry.State.Families[index].Family)
+					assert.Equal(t, family.Up, entry.State.Families[index].Up)
+				}
+			})
+		}
+	}
+}
+
+func TestMonitor_CheckSites_IPFamily_AllAddresses(t *testing.T) {
+	port := newAddressServers(t, nil, "127.0.0.1", "::1")
+	dnsServer := newDNSServer(t,
+		aRecord("www.example.com.", "127.0.0.1", 300),
+		aaaaRecord("www.example.com.", "::1", 300),
+	)
+	defer dnsServer.close()
+	url := "http://www.example.com:" + port
+
+	testCases := []struct {
+		family    string
+		addresses []string
+	}{
+		{family: monitor.IPFamilyV4, addresses: []string{"127.0.0.1"}},
+		{family: monitor.IPFamilyV6, addresses: []string{"::1"}},
+		{family: monitor.IPFamilyBoth, addresses: []string{"127.0.0.1", "::1"}},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.family, func(t *testing.T) {
+			m := newMonitor(t, monitor.SiteSpec{URL: url, AllAddresses: true, IPFamily: tt.family, Timeout: monitor.Duration{Duration: time.Second}})
+			m.Resolver = newResolver(dnsServer.address())
+			m.CheckSites(context.Background())
+
+			entry, ok := m.GetEntry(url)
+			require.True(t, ok)
+			require.NotNil(t, entry.State)
+			assert.True(t, entry.State.Up)
+			assert.Empty(t, entry.State.LastError)
+			var addresses []string
+			for _, address := range entry.State.Addresses {
+				addresses = append(addresses, address.Address)
+				assert.True(t, address.Up, address.Address)
+			}
+			assert.Equal(t, tt.addresses, addresses)
+		})
+	}
+}
+
+func TestCollector_Collect_IPFamily(t *testing.T) {
+	port := newAddressServers(t, nil, "127.0.0.1")
+	url := "tcp://127.0.0.1:" + port
+
+	m := newMonitor(t, monitor.SiteSpec{URL: url, IPFamily: monitor.IPFamilyBoth, Timeout: monitor.Duration{Duration: time.Second}})
+	m.CheckSites(context.Background())
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		m.Collect(ch)
+		close(ch)
+	}()
+
+	up := make(map[string]float64)
+	latency := make(map[string]float64)
+	for metric := range ch {
+		switch metrics.MetricName(metric) {
+		case "webmon_site_up":
+			assert.Equal(t, 0.0, metrics.MetricValue(metric).GetGauge().GetValue())
+		case "webmon_site_family_up":
+			up[metrics.MetricLabel(metric, "family")] = metrics.MetricValue(metric).GetGauge().GetValue()
+		case "webmon_site_family_latency_seconds":
+			latency[metrics.MetricLabel(metric, "family")] = metrics.MetricValue(metric).GetGauge().GetValue()
+		}
+	}
+	assert.Equal(t, map[string]float64{"v4": 1.0, "v6": 0.0}, up)
+	require.Contains(t, latency, "v4")
+	assert.NotContains(t, latency, "v6")
+}
@@ -2,7 +2,11 @@ package monitor
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	log "github.com/sirupsen/logrus"
+	"net"
 	"net/http"
 	"sync"
 	"time"
@@ -11,28 +15,40 @@ import (
 // DefaultMaxConcurrentChecks specifies the default maximum number of parallel checks
 const DefaultMaxConcurrentChecks = 5
 
+// DefaultTimeout specifies how long a check may take, if the site's SiteSpec doesn't specify a timeout
+const DefaultTimeout = 30 * time.Second
+
 // A Monitor checks a list of website, either on a continuous basis through the Run() function, or on demand via the CheckSites method.
 // See the Entry structure for attributes of a site that are checked.
 type Monitor struct {
-	// The Register channel is used to add a host to the monitor
+	// The Register channel is used to add a host to the monitor, or to update an existing one. It is only served
+	// while Run is running. Use AddSite/UpdateSite instead, which don't block and report any errors.
 	Register chan SiteSpec
-	// The Unregister channel is used to remove a host from the monitor
+	// The Unregister channel is used to remove a host from the monitor. It is only served while Run is running.
+	// Use RemoveSite instead, which doesn't block and reports any errors.
 	Unregister chan SiteSpec
 	// HTTPClient is the http.Client that will be used to check sites.
 	// Under normal circumstances, this can be left blank and Monitor will create the required client.
 	HTTPClient *http.Client
-	// MaxConcurrentChecks limits the number of sites that are checked in parallel. Default: DefaultMaxConcurrentChecks
+	// Resolver is used to look up the IP addresses of sites that are checked at each of their addresses.
+	// Default: net.DefaultResolver
+	Resolver *net.Resolver
+	// MaxConcurrentChecks limits the number of sites that are checked in parallel, and the number of addresses of a site
+	// that are checked in parallel (see SiteSpec.AllAddresses). Default: DefaultMaxConcurrentChecks
 	MaxConcurrentChecks int64
 
-	sites map[string]Entry
-	lock  sync.RWMutex
+	sites    map[string]Entry
+	schedule *scheduler
+	interval time.Duration
+	wakeup   chan struct{}
+	lock     sync.RWMutex
 }
 
 // New creates a new Monitor instance for the specified list of sites
 func New(hosts []string) (monitor *Monitor) {
 	monitor = &Monitor{
 		HTTPClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Transport: newTransport(),
 			CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
 				return http.ErrUseLastResponse
 			},
@@ -40,6 +56,8 @@ func New(hosts []string) (monitor *Monitor) {
 		Register:   make(chan SiteSpec),
 		Unregister: make(chan SiteSpec),
 		sites:      make(map[string]Entry),
+		schedule:   newScheduler(),
+		wakeup:     make(chan struct{}, 1),
 	}
 
 	for _, host := range hosts {
@@ -49,49 +67,147 @@ func New(hosts []string) (monitor *Monitor) {
 	return
 }
 
-// Run calls CheckSites on a recurring basis, based on the specified interval.
+// newTransport returns the http.Transport used to check sites. Keep-alives are disabled, so each check sets up a
+// new connection and all phases of the check are measured. Legacy TLS versions and cipher suites are offered, so the
+// TLS version and cipher suite of legacy sites are reported, rather than the handshake failing.
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = true
+	transport.TLSClientConfig = &tls.Config{}
+	allowLegacy(transport.TLSClientConfig)
+	return transport
+}
+
+// Run checks each site on a recurring basis. Sites are checked at the interval specified in their SiteSpec.
+// Sites that don't specify an interval are checked at the specified (default) interval, which must be positive.
+// Each site is checked as soon as Run starts, or when the site is added or its specification changes.
+// At most MaxConcurrentChecks sites are checked in parallel. A site whose previous check is still running (e.g. because
+// its timeout is longer than its interval) skips its next check, so a hanging site doesn't hold up other sites.
+//
 // To be able to stop this function, call it with a context obtained by context.WithCancel()
 // and then call cancel() when required.
 func (monitor *Monitor) Run(ctx context.Context, interval time.Duration) (err error) {
+	if interval <= 0 {
+		return fmt.Errorf("invalid interval %s: must be positive", interval)
+	}
 	log.Info("monitor started")
 
-	ticker := time.NewTicker(interval)
+	monitor.startSchedule(interval)
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := int64(0); i < monitor.maxConcurrentChecks(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for url := range jobs {
+				monitor.checkAndUpdate(ctx, url)
+				monitor.checkDone(url)
+			}
+		}()
+	}
+
+	timer := time.NewTimer(monitor.nextCheck())
 	for running := true; running; {
 		select {
 		case <-ctx.Done():
 			running = false
-		case <-ticker.C:
-			monitor.CheckSites(ctx)
+		case <-timer.C:
+			for _, url := range monitor.dueSites() {
+				select {
+				case jobs <- url:
+				case <-ctx.Done():
+				}
+			}
+		case <-monitor.wakeup:
 		case site := <-monitor.Register:
 			monitor.register(site)
 		case site := <-monitor.Unregister:
 			monitor.unregister(site)
 		}
+
+		if timer.Stop() == false {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(monitor.nextCheck())
 	}
-	ticker.Stop()
+	timer.Stop()
+	close(jobs)
+	wg.Wait()
 
 	log.Info("monitor stopped")
 	return
 }
 
-func (monitor *Monitor) register(site SiteSpec) {
+func (monitor *Monitor) startSchedule(interval time.Duration) {
 	monitor.lock.Lock()
 	defer monitor.lock.Unlock()
 
-	entry, ok := monitor.sites[site.URL]
+	monitor.interval = interval
+	for url, entry := range monitor.sites {
+		monitor.schedule.add(url, monitor.siteInterval(entry.Spec), time.Now())
+	}
+}
+
+// nextCheck returns how long to wait until the next site needs to be checked
+func (monitor *Monitor) nextCheck() time.Duration {
+	monitor.lock.RLock()
+	defer monitor.lock.RUnlock()
+
+	due, ok := monitor.schedule.next()
 	if ok == false {
-		log.WithField("url", site.URL).Info("registering new url")
+		return monitor.interval
 	}
-	entry.Spec = site
-	monitor.sites[site.URL] = entry
+	return time.Until(due)
 }
 
-func (monitor *Monitor) unregister(site SiteSpec) {
+func (monitor *Monitor) dueSites() []string {
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+
+	return monitor.schedule.popDue(time.Now())
+}
+
+// checkDone marks the site's scheduled check as completed
+func (monitor *Monitor) checkDone(url string) {
 	monitor.lock.Lock()
 	defer monitor.lock.Unlock()
 
-	log.WithField("url", site.URL).Info("unregistering url")
-	delete(monitor.sites, site.URL)
+	monitor.schedule.done(url)
+}
+
+func (monitor *Monitor) siteInterval(site SiteSpec) time.Duration {
+	if site.Interval.Duration > 0 {
+		return site.Interval.Duration
+	}
+	return monitor.interval
+}
+
+func (monitor *Monitor) maxConcurrentChecks() int64 {
+	if monitor.MaxConcurrentChecks > 0 {
+		return monitor.MaxConcurrentChecks
+	}
+	return DefaultMaxConcurrentChecks
+}
+
+// register adds the site, or updates it if it is already being monitored
+func (monitor *Monitor) register(site SiteSpec) {
+	err := monitor.AddSite(site)
+	if errors.Is(err, ErrDuplicateSite) {
+		err = monitor.UpdateSite(site)
+	}
+	if err != nil {
+		log.WithError(err).Error("failed to register site")
+	}
+}
+
+func (monitor *Monitor) unregister(site SiteSpec) {
+	if err := monitor.RemoveSite(site.URL); err != nil {
+		log.WithError(err).Warning("failed to unregister site")
+	}
 }
 
 // GetEntry returns the monitor's entry for the specified site URL.
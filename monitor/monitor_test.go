@@ -7,6 +7,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 )
@@ -40,3 +41,137 @@ func TestMonitor_Register(t *testing.T) {
 		return !ok
 	}, 500*time.Millisecond, 10*time.Millisecond)
 }
+
+func TestMonitor_Run_Intervals(t *testing.T) {
+	fast := &countingStub{}
+	fastServer := httptest.NewServer(http.HandlerFunc(fast.Handle))
+	defer fastServer.Close()
+	slow := &countingStub{}
+	slowServer := httptest.NewServer(http.HandlerFunc(slow.Handle))
+	defer slowServer.Close()
+	other := &countingStub{}
+	otherServer := httptest.NewServer(http.HandlerFunc(other.Handle))
+	defer otherServer.Close()
+
+	m := monitor.New([]string{otherServer.URL})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		err := m.Run(ctx, 100*time.Millisecond)
+		require.NoError(t, err)
+	}()
+
+	m.Register <- monitor.SiteSpec{URL: fastServer.URL, Interval: monitor.Duration{Duration: 20 * time.Millisecond}}
+	m.Register <- monitor.SiteSpec{URL: slowServer.URL, Interval: monitor.Duration{Duration: time.Hour}}
+
+	assert.Eventually(t, func() bool { return fast.count() >= 10 }, time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool { return other.count() >= 3 }, time.Second, 10*time.Millisecond)
+	// slow site is only checked when it's registered
+	assert.Equal(t, 1, slow.count())
+	assert.Less(t, other.count(), fast.count())
+
+	// changing the interval to a shorter value takes effect immediately
+	m.Register <- monitor.SiteSpec{URL: slowServer.URL, Interval: monitor.Duration{Duration: 20 * time.Millisecond}}
+	assert.Eventually(t, func() bool { return slow.count() >= 3 }, time.Second, 10*time.Millisecond)
+
+	// unregistered sites are no longer checked
+	m.Unregister <- monitor.SiteSpec{URL: fastServer.URL}
+	time.Sleep(50 * time.Millisecond)
+	count := fast.count()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, count, fast.count())
+}
+
+func TestMonitor_Run_InvalidInterval(t *testing.T) {
+	m := monitor.New([]string{"https://example.com"})
+
+	for _, interval := range []time.Duration{0, -time.Minute} {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		err := m.Run(ctx, interval)
+		cancel()
+		assert.EqualError(t, err, "invalid interval "+interval.String()+": must be positive")
+	}
+}
+
+func TestMonitor_Run_HangingSite(t *testing.T) {
+	hang := make(chan struct{})
+	hangingServer := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) { <-hang }))
+	defer hangingServer.Close()
+	defer close(hang)
+	healthy := &countingStub{}
+	healthyServer := httptest.NewServer(http.HandlerFunc(healthy.Handle))
+	defer healthyServer.Close()
+
+	m := monitor.New(nil)
+	m.MaxConcurrentChecks = 3
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		err := m.Run(ctx, time.Hour)
+		require.NoError(t, err)
+	}()
+
+	// the hanging site's checks don't overlap, so they don't use up all workers
+	interval := monitor.Duration{Duration: 50 * time.Millisecond}
+	m.Register <- monitor.SiteSpec{URL: hangingServer.URL, Interval: interval, Timeout: monitor.Duration{Duration: 2 * time.Second}}
+	m.Register <- monitor.SiteSpec{URL: healthyServer.URL, Interval: interval}
+
+	assert.Eventually(t, func() bool { return healthy.count() >= 10 }, time.Second, 10*time.Millisecond)
+}
+
+func TestMonitor_Run_CheckImmediately(t *testing.T) {
+	stub := &countingStub{}
+	testServer := httptest.NewServer(http.HandlerFunc(stub.Handle))
+	defer testServer.Close()
+	other := &countingStub{}
+	otherServer := httptest.NewServer(http.HandlerFunc(other.Handle))
+	defer otherServer.Close()
+
+	// sites known when the monitor starts are checked immediately
+	m := monitor.New([]string{otherServer.URL})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		err := m.Run(ctx, time.Hour)
+		require.NoError(t, err)
+	}()
+	assert.Eventually(t, func() bool { return other.count() == 1 }, time.Second, 10*time.Millisecond)
+
+	// new sites are checked immediately
+	require.NoError(t, m.AddSite(monitor.SiteSpec{URL: testServer.URL}))
+	assert.Eventually(t, func() bool {
+		entry, ok := m.GetEntry(testServer.URL)
+		return ok && entry.State != nil && entry.State.Up
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, stub.count())
+
+	// updating the site without changing its specification doesn't trigger a check
+	require.NoError(t, m.UpdateSite(monitor.SiteSpec{URL: testServer.URL}))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, stub.count())
+
+	// changing the site's specification does
+	require.NoError(t, m.UpdateSite(monitor.SiteSpec{URL: testServer.URL, Name: "test"}))
+	assert.Eventually(t, func() bool { return stub.count() == 2 }, time.Second, 10*time.Millisecond)
+
+	// other sites' schedule isn't affected
+	assert.Equal(t, 1, other.count())
+}
+
+type countingStub struct {
+	calls int
+	lock  sync.Mutex
+}
+
+func (stub *countingStub) Handle(w http.ResponseWriter, _ *http.Request) {
+	stub.lock.Lock()
+	defer stub.lock.Unlock()
+	stub.calls++
+	w.WriteHeader(http.StatusOK)
+}
+
+func (stub *countingStub) count() int {
+	stub.lock.Lock()
+	defer stub.lock.Unlock()
+	return stub.calls
+}
@@ -0,0 +1,68 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// A Header is added to the HTTP request when checking a site
+type Header struct {
+	// Name of the header. Use "Host" to override the request's virtual host
+	Name string `json:"name"`
+	// Value of the header
+	Value string `json:"value,omitempty"`
+	// ValueFile is the name of a file containing the header's value. The file is read on every check, so it can be
+	// used to keep secrets (e.g. API keys) out of the site's specification. Takes precedence over Value
+	ValueFile string `json:"value_file,omitempty"`
+	// SecretValue contains a secret header value (e.g. obtained from a Kubernetes Secret). It takes precedence over
+	// Value and ValueFile and is never included in the JSON representation of a site
+	SecretValue string `json:"-"`
+}
+
+func (header Header) value() (string, error) {
+	if header.SecretValue != "" {
+		return header.SecretValue, nil
+	}
+	if header.ValueFile != "" {
+		content, err := os.ReadFile(header.ValueFile)
+		if err != nil {
+			return "", fmt.Errorf("header %s: %w", header.Name, err)
+		}
+		return strings.TrimSpace(string(content)), nil
+	}
+	return header.Value, nil
+}
+
+// newRequest creates the HTTP request to check the site
+func newRequest(ctx context.Context, site SiteSpec) (req *http.Request, err error) {
+	method := site.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var body io.Reader
+	if site.Body != "" {
+		body = strings.NewReader(site.Body)
+	}
+
+	if req, err = http.NewRequestWithContext(ctx, method, site.URL, body); err != nil {
+		return nil, err
+	}
+
+	for _, header := range site.Headers {
+		var value string
+		if value, err = header.value(); err != nil {
+			return nil, err
+		}
+		if http.CanonicalHeaderKey(header.Name) == "Host" {
+			req.Host = value
+		} else {
+			req.Header.Add(header.Name, value)
+		}
+	}
+	return
+}
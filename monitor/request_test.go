@@ -0,0 +1,105 @@
+package monitor_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/clambin/webmon/monitor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestMonitor_CheckSites_Request(t *testing.T) {
+	stub := &requestStub{}
+	testServer := httptest.NewServer(http.HandlerFunc(stub.Handle))
+	defer testServer.Close()
+
+	keyFile := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("file-key\n"), 0600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := newMonitor(t, monitor.SiteSpec{
+		URL:    testServer.URL,
+		Method: http.MethodPost,
+		Headers: []monitor.Header{
+			{Name: "Host", Value: "example.com"},
+			{Name: "Accept", Value: "application/json"},
+			{Name: "X-API-Key", ValueFile: keyFile},
+			{Name: "Authorization", Value: "foo", SecretValue: "Bearer secret"},
+		},
+		Body: `{"ping":true}`,
+	})
+
+	m.CheckSites(ctx)
+
+	entry, ok := m.GetEntry(testServer.URL)
+	require.True(t, ok)
+	require.NotNil(t, entry.State)
+	assert.True(t, entry.State.Up)
+
+	req := stub.lastRequest()
+	assert.Equal(t, http.MethodPost, req.method)
+	assert.Equal(t, "example.com", req.host)
+	assert.Equal(t, "application/json", req.header.Get("Accept"))
+	assert.Equal(t, "file-key", req.header.Get("X-API-Key"))
+	assert.Equal(t, "Bearer secret", req.header.Get("Authorization"))
+	assert.Equal(t, `{"ping":true}`, req.body)
+
+	out, err := json.Marshal(entry.Spec)
+	require.NoError(t, err)
+	assert.NotContains(t, string(out), "secret")
+}
+
+func TestMonitor_CheckSites_Request_MissingFile(t *testing.T) {
+	stub := &requestStub{}
+	testServer := httptest.NewServer(http.HandlerFunc(stub.Handle))
+	defer testServer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := newMonitor(t, monitor.SiteSpec{
+		URL:     testServer.URL,
+		Headers: []monitor.Header{{Name: "X-API-Key", ValueFile: filepath.Join(t.TempDir(), "missing")}},
+	})
+
+	m.CheckSites(ctx)
+
+	entry, ok := m.GetEntry(testServer.URL)
+	require.True(t, ok)
+	require.NotNil(t, entry.State)
+	assert.False(t, entry.State.Up)
+	assert.Contains(t, entry.State.LastError, "failed to create request: header X-API-Key: open ")
+}
+
+type receivedRequest struct {
+	method string
+	host   string
+	header http.Header
+	body   string
+}
+
+type requestStub struct {
+	request receivedRequest
+	lock    sync.Mutex
+}
+
+func (stub *requestStub) Handle(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	stub.lock.Lock()
+	defer stub.lock.Unlock()
+	stub.request = receivedRequest{method: req.Method, host: req.Host, header: req.Header, body: string(body)}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (stub *requestStub) lastRequest() receivedRequest {
+	stub.lock.Lock()
+	defer stub.lock.Unlock()
+	return stub.request
+}
@@ -0,0 +1,70 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultRetryBackoff is the time to wait before the first retry of a failed check, if the site doesn't specify one.
+// The backoff doubles after each retry, up to MaxRetryBackoff.
+const DefaultRetryBackoff = time.Second
+
+// MaxRetryBackoff is the longest time to wait before retrying a failed check
+const MaxRetryBackoff = 30 * time.Second
+
+// applyThresholds updates the state's failure & success streaks and determines if the site is up, based on the
+// site's FailureThreshold and SuccessThreshold. previous is the site's last known state, or nil if this is the
+// site's first check. Up is set to the outcome of the check until a threshold is reached. If a failed check doesn't
+// yet mark the site as down, its error is moved from LastError to MaskedError. If a successful check doesn't yet mark
+// the site as up, LastError reports how many successful checks are needed.
+func (state *SiteState) applyThresholds(site SiteSpec, previous *SiteState) {
+	if previous == nil || previous.LastCheck.IsZero() {
+		// no previous state: report the outcome of the check as-is
+		previous = &SiteState{Up: state.Up}
+	}
+
+	if state.Up {
+		state.SuccessStreak = previous.SuccessStreak + 1
+		state.FailureStreak = 0
+		if previous.Up == false && state.SuccessStreak < threshold(site.SuccessThreshold) {
+			state.Up = false
+			state.LastError = fmt.Sprintf("waiting for %d consecutive successful checks", threshold(site.SuccessThreshold))
+		}
+	} else {
+		state.FailureStreak = previous.FailureStreak + 1
+		state.SuccessStreak = 0
+		if previous.Up && state.FailureStreak < threshold(site.FailureThreshold) {
+			state.Up = true
+			state.MaskedError, state.LastError = state.LastError, ""
+		}
+	}
+}
+
+func threshold(value int) int {
+	if value < 1 {
+		return 1
+	}
+	return value
+}
+
+// nextBackoff returns the time to wait before the next retry, doubling the current backoff up to MaxRetryBackoff
+func nextBackoff(backoff time.Duration) time.Duration {
+	if backoff *= 2; backoff > MaxRetryBackoff {
+		backoff = MaxRetryBackoff
+	}
+	return backoff
+}
+
+// wait waits for the specified duration. It returns false if the context was cancelled before the duration elapsed.
+func wait(ctx context.Context, duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
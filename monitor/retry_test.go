@@ -0,0 +1,195 @@
+package monitor_test
+
+import (
+	"context"
+	"github.com/clambin/gotools/metrics"
+	"github.com/clambin/webmon/monitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMonitor_CheckSites_Retries(t *testing.T) {
+	testCases := []struct {
+		name     string
+		retries  int
+		up       bool
+		attempts int
+	}{
+		{name: "no retries", retries: 0, up: false, attempts: 1},
+		{name: "not enough retries", retries: 1, up: false, attempts: 2},
+		{name: "retries", retries: 3, up: true, attempts: 3},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			// fail the first two requests
+			stub := &flakyStub{failures: 2}
+			testServer := httptest.NewServer(http.HandlerFunc(stub.Handle))
+			defer testServer.Close()
+
+			m := newMonitor(t, monitor.SiteSpec{
+				URL:          testServer.URL,
+				Retries:      tt.retries,
+				RetryBackoff: monitor.Duration{Duration: 10 * time.Millisecond},
+			})
+			m.CheckSites(context.Background())
+
+			entry, ok := m.GetEntry(testServer.URL)
+			require.True(t, ok)
+			require.NotNil(t, entry.State)
+			assert.Equal(t, tt.up, entry.State.Up)
+			assert.Equal(t, tt.attempts, entry.State.Attempts)
+			assert.False(t, entry.State.LastCheck.IsZero())
+		})
+	}
+}
+
+func TestMonitor_CheckSites_Retries_Cancelled(t *testing.T) {
+	stub := &serverStub{}
+	stub.StatusCode(http.StatusInternalServerError)
+	testServer := httptest.NewServer(http.HandlerFunc(stub.Handle))
+	defer testServer.Close()
+
+	m := newMonitor(t, monitor.SiteSpec{
+		URL:          testServer.URL,
+		Retries:      5,
+		RetryBackoff: monitor.Duration{Duration: time.Hour},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	m.CheckSites(ctx)
+
+	entry, ok := m.GetEntry(testServer.URL)
+	require.True(t, ok)
+	require.NotNil(t, entry.State)
+	assert.False(t, entry.State.Up)
+	assert.Equal(t, 1, entry.State.Attempts)
+}
+
+func TestMonitor_CheckSites_Retries_Interval(t *testing.T) {
+	stub := &serverStub{}
+	stub.StatusCode(http.StatusInternalServerError)
+	testServer := httptest.NewServer(http.HandlerFunc(stub.Handle))
+	defer testServer.Close()
+
+	// the second retry would start after the site's interval
+	m := newMonitor(t, monitor.SiteSpec{
+		URL:          testServer.URL,
+		Interval:     monitor.Duration{Duration: 200 * time.Millisecond},
+		Retries:      5,
+		RetryBackoff: monitor.Duration{Duration: 100 * time.Millisecond},
+	})
+
+	start := time.Now()
+	m.CheckSites(context.Background())
+	assert.Less(t, time.Since(start), 200*time.Millisecond)
+
+	entry, ok := m.GetEntry(testServer.URL)
+	require.True(t, ok)
+	require.NotNil(t, entry.State)
+	assert.False(t, entry.State.Up)
+	assert.Equal(t, 2, entry.State.Attempts)
+}
+
+func TestMonitor_CheckSites_Thresholds(t *testing.T) {
+	stub := &serverStub{}
+	testServer := httptest.NewServer(http.HandlerFunc(stub.Handle))
+	defer testServer.Close()
+
+	m := newMonitor(t, monitor.SiteSpec{URL: testServer.URL, FailureThreshold: 2, SuccessThreshold: 3})
+
+	for i, step := range []struct {
+		statusCode    int
+		up            bool
+		masked        bool
+		failureStreak int
+		successStreak int
+	}{
+		{statusCode: http.StatusOK, up: true, successStreak: 1},
+		{statusCode: http.StatusInternalServerError, up: true, masked: true, failureStreak: 1},
+		{statusCode: http.StatusOK, up: true, successStreak: 1},
+		{statusCode: http.StatusInternalServerError, up: true, masked: true, failureStreak: 1},
+		{statusCode: http.StatusInternalServerError, up: false, failureStreak: 2},
+		{statusCode: http.StatusOK, up: false, successStreak: 1},
+		{statusCode: http.StatusOK, up: false, successStreak: 2},
+		{statusCode: http.StatusOK, up: true, successStreak: 3},
+	} {
+		stub.StatusCode(step.statusCode)
+		m.CheckSites(context.Background())
+
+		entry, ok := m.GetEntry(testServer.URL)
+		require.True(t, ok)
+		require.NotNil(t, entry.State)
+		assert.Equal(t, step.up, entry.State.Up, i)
+		assert.Equal(t, step.failureStreak, entry.State.FailureStreak, i)
+		assert.Equal(t, step.successStreak, entry.State.SuccessStreak, i)
+		// a site that is reported as up has no LastError. A site held down by SuccessThreshold reports why
+		assert.Equal(t, step.masked, entry.State.MaskedError != "", i)
+		assert.Equal(t, step.up == false, entry.State.LastError != "", i)
+		if step.up == false && step.statusCode == http.StatusOK {
+			assert.Equal(t, "waiting for 3 consecutive successful checks", entry.State.LastError, i)
+		}
+	}
+}
+
+func TestCollector_Collect_FailureStreak(t *testing.T) {
+	stub := &serverStub{}
+	testServer := httptest.NewServer(http.HandlerFunc(stub.Handle))
+	defer testServer.Close()
+
+	m := newMonitor(t, monitor.SiteSpec{URL: testServer.URL, FailureThreshold: 5})
+	stub.StatusCode(http.StatusOK)
+	m.CheckSites(context.Background())
+	stub.StatusCode(http.StatusInternalServerError)
+	for i := 0; i < 3; i++ {
+		m.CheckSites(context.Background())
+	}
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		m.Collect(ch)
+		close(ch)
+	}()
+
+	var found bool
+	for metric := range ch {
+		desc := metric.Desc().String()
+		switch {
+		case strings.Contains(desc, "\"webmon_site_failure_streak\""):
+			found = true
+			assert.Equal(t, 3.0, metrics.MetricValue(metric).GetGauge().GetValue())
+		case strings.Contains(desc, "\"webmon_site_up\""):
+			assert.Equal(t, 1.0, metrics.MetricValue(metric).GetGauge().GetValue())
+		case strings.Contains(desc, "\"webmon_site_latency_seconds\""), strings.Contains(desc, "\"webmon_site_phase_latency_seconds\""):
+			// the failures are masked by FailureThreshold, so there are no measurements to report
+			t.Errorf("unexpected metric for masked failure: %s", desc)
+		}
+	}
+	assert.True(t, found)
+}
+
+// flakyStub returns an error for the first requests, followed by HTTP 200
+type flakyStub struct {
+	failures int
+	lock     sync.Mutex
+}
+
+func (stub *flakyStub) Handle(w http.ResponseWriter, _ *http.Request) {
+	stub.lock.Lock()
+	defer stub.lock.Unlock()
+
+	if stub.failures > 0 {
+		stub.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,207 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ocsp"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Revocation status of a site's certificate. See SiteState.Revocation
+const (
+	RevocationGood    = "good"
+	RevocationRevoked = "revoked"
+	RevocationUnknown = "unknown"
+)
+
+// Sources of a site's revocation status. See SiteState.RevocationSource
+const (
+	RevocationSourceStapled = "stapled"
+	RevocationSourceOCSP    = "ocsp"
+	RevocationSourceCRL     = "crl"
+)
+
+// maxRevocationResponseSize limits the size of OCSP responses and CRLs
+const maxRevocationResponseSize = 10 << 20
+
+// checkRevocation determines if the site's certificate has been revoked. If the site stapled an OCSP response,
+// that response is used. Otherwise (or if the stapled response is invalid or expired), the certificate's OCSP responders
+// are queried, followed by its CRL distribution points. If the status can't be determined, status is RevocationUnknown
+// and err contains the reason for each source that was tried.
+func (monitor *Monitor) checkRevocation(ctx context.Context, connection *tls.ConnectionState) (status, source string, err error) {
+	status = RevocationUnknown
+	if len(connection.PeerCertificates) == 0 {
+		return status, "", errors.New("no certificates presented")
+	}
+	leaf := connection.PeerCertificates[0]
+	issuer := issuerCertificate(connection)
+	if issuer == nil {
+		return status, "", errors.New("issuer certificate not found")
+	}
+
+	var errs revocationErrors
+	if len(connection.OCSPResponse) > 0 {
+		if status, err = parseOCSPResponse(connection.OCSPResponse, leaf, issuer); err == nil {
+			return status, RevocationSourceStapled, nil
+		}
+		errs = append(errs, fmt.Errorf("stapled ocsp: %w", err))
+	}
+	for _, server := range leaf.OCSPServer {
+		if status, err = monitor.queryOCSP(ctx, server, leaf, issuer); err == nil {
+			return status, RevocationSourceOCSP, nil
+		}
+		errs = append(errs, fmt.Errorf("ocsp %s: %w", server, err))
+	}
+	for _, distributionPoint := range leaf.CRLDistributionPoints {
+		if status, err = monitor.queryCRL(ctx, distributionPoint, leaf, issuer); err == nil {
+			return status, RevocationSourceCRL, nil
+		}
+		errs = append(errs, fmt.Errorf("crl %s: %w", distributionPoint, err))
+	}
+
+	if len(errs) == 0 {
+		return RevocationUnknown, "", errors.New("certificate has no OCSP responder or CRL distribution point")
+	}
+	return RevocationUnknown, "", errs
+}
+
+// revocationErrors contains the reason why each source of a certificate's revocation status failed
+type revocationErrors []error
+
+func (errs revocationErrors) Error() string {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Is reports whether any of the sources' errors matches target
+func (errs revocationErrors) Is(target error) bool {
+	for _, err := range errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the sources' errors that matches target
+func (errs revocationErrors) As(target interface{}) bool {
+	for _, err := range errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// issuerCertificate returns the certificate of the leaf certificate's issuer, either from the presented chain or
+// from the verified chain
+func issuerCertificate(connection *tls.ConnectionState) *x509.Certificate {
+	leaf := connection.PeerCertificates[0]
+	candidates := connection.PeerCertificates[1:]
+	for _, chain := range connection.VerifiedChains {
+		if len(chain) > 1 {
+			candidates = append(candidates, chain[1])
+		}
+	}
+	for _, candidate := range candidates {
+		if leaf.CheckSignatureFrom(candidate) == nil {
+			return candidate
+		}
+	}
+	return nil
+}
+
+func parseOCSPResponse(response []byte, leaf, issuer *x509.Certificate) (string, error) {
+	parsed, err := ocsp.ParseResponseForCert(response, leaf, issuer)
+	if err != nil {
+		return RevocationUnknown, fmt.Errorf("invalid OCSP response: %w", err)
+	}
+	if err = checkNextUpdate(parsed.NextUpdate); err != nil {
+		return RevocationUnknown, fmt.Errorf("OCSP response %w", err)
+	}
+	switch parsed.Status {
+	case ocsp.Good:
+		return RevocationGood, nil
+	case ocsp.Revoked:
+		return RevocationRevoked, nil
+	default:
+		return RevocationUnknown, nil
+	}
+}
+
+func (monitor *Monitor) queryOCSP(ctx context.Context, server string, leaf, issuer *x509.Certificate) (string, error) {
+	request, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return RevocationUnknown, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server, bytes.NewReader(request))
+	if err != nil {
+		return RevocationUnknown, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+
+	response, err := monitor.fetch(req)
+	if err != nil {
+		return RevocationUnknown, err
+	}
+	return parseOCSPResponse(response, leaf, issuer)
+}
+
+func (monitor *Monitor) queryCRL(ctx context.Context, distributionPoint string, leaf, issuer *x509.Certificate) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, distributionPoint, nil)
+	if err != nil {
+		return RevocationUnknown, err
+	}
+	response, err := monitor.fetch(req)
+	if err != nil {
+		return RevocationUnknown, err
+	}
+	crl, err := x509.ParseCRL(response)
+	if err != nil {
+		return RevocationUnknown, fmt.Errorf("invalid CRL: %w", err)
+	}
+	if err = issuer.CheckCRLSignature(crl); err != nil {
+		return RevocationUnknown, fmt.Errorf("invalid CRL signature: %w", err)
+	}
+	if err = checkNextUpdate(crl.TBSCertList.NextUpdate); err != nil {
+		return RevocationUnknown, fmt.Errorf("CRL %w", err)
+	}
+	for _, revoked := range crl.TBSCertList.RevokedCertificates {
+		if revoked.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+			return RevocationRevoked, nil
+		}
+	}
+	return RevocationGood, nil
+}
+
+// checkNextUpdate returns an error if the time at which newer revocation information is available has passed, so a
+// stale (or replayed) response isn't taken as the certificate's current status. A zero nextUpdate never expires.
+func checkNextUpdate(nextUpdate time.Time) error {
+	if nextUpdate.IsZero() == false && time.Now().After(nextUpdate) {
+		return fmt.Errorf("expired at %s", nextUpdate.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// fetch performs the request and returns the response body
+func (monitor *Monitor) fetch(req *http.Request) ([]byte, error) {
+	resp, err := monitor.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status code %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxRevocationResponseSize))
+}
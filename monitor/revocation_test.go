@@ -0,0 +1,207 @@
+package monitor_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/clambin/gotools/metrics"
+	"github.com/clambin/webmon/monitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMonitor_CheckSites_Revocation(t *testing.T) {
+	root := newTestCA(t, "Test Root CA", nil, 365*24*time.Hour)
+	responder := newRevocationServer(t, root)
+	defer responder.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	ocspServer := func(servers ...string) func(*x509.Certificate) {
+		return func(template *x509.Certificate) { template.OCSPServer = servers }
+	}
+	crlServer := func(template *x509.Certificate) {
+		template.CRLDistributionPoints = []string{responder.URL + "/crl"}
+	}
+
+	testCases := []struct {
+		name      string
+		modify    func(*x509.Certificate)
+		revoked   bool
+		staple    bool
+		expired   bool
+		up        bool
+		status    string
+		source    string
+		lastError string
+		// revocationError lists (part of) the reason for each source that failed
+		revocationError []string
+	}{
+		{name: "ocsp - good", modify: ocspServer(responder.URL), up: true, status: monitor.RevocationGood, source: monitor.RevocationSourceOCSP},
+		{name: "ocsp - revoked", modify: ocspServer(responder.URL), revoked: true, up: false, status: monitor.RevocationRevoked, source: monitor.RevocationSourceOCSP, lastError: "certificate has been revoked"},
+		{name: "ocsp - failover", modify: ocspServer(down.URL, responder.URL), revoked: true, up: false, status: monitor.RevocationRevoked, source: monitor.RevocationSourceOCSP, lastError: "certificate has been revoked"},
+		{name: "ocsp - down", modify: ocspServer(down.URL), up: true, status: monitor.RevocationUnknown},
+		{name: "stapled - good", modify: ocspServer(down.URL), staple: true, up: true, status: monitor.RevocationGood, source: monitor.RevocationSourceStapled},
+		{name: "stapled - revoked", modify: ocspServer(down.URL), staple: true, revoked: true, up: false, status: monitor.RevocationRevoked, source: monitor.RevocationSourceStapled, lastError: "certificate has been revoked"},
+		{name: "crl - good", modify: crlServer, up: true, status: monitor.RevocationGood, source: monitor.RevocationSourceCRL},
+		{name: "crl - revoked", modify: crlServer, revoked: true, up: false, status: monitor.RevocationRevoked, source: monitor.RevocationSourceCRL, lastError: "certificate has been revoked"},
+		{name: "none", up: true, status: monitor.RevocationUnknown},
+		{name: "ocsp - expired", modify: ocspServer(responder.URL), expired: true, up: true, status: monitor.RevocationUnknown, revocationError: []string{"ocsp " + responder.URL + ": OCSP response expired at "}},
+		{name: "stapled - expired", modify: ocspServer(down.URL), staple: true, expired: true, up: true, status: monitor.RevocationUnknown, revocationError: []string{"stapled ocsp: OCSP response expired at ", "ocsp " + down.URL + ": unexpected HTTP status code 503"}},
+		{name: "crl - expired", modify: crlServer, revoked: true, expired: true, up: true, status: monitor.RevocationUnknown, revocationError: []string{"crl " + responder.URL + "/crl: CRL expired at "}},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			certificate := root.issueWith(t, 24*time.Hour, tt.modify, "127.0.0.1")
+			if tt.revoked {
+				responder.revoke(certificate.Leaf.SerialNumber)
+			}
+			responder.setExpired(tt.expired)
+			if tt.staple {
+				certificate.OCSPStaple = responder.response(t, certificate.Leaf.SerialNumber)
+			}
+			testServer := newTLSServer(t, certificate)
+			defer testServer.Close()
+
+			m := newMonitor(t, monitor.SiteSpec{URL: testServer.URL, TLS: &monitor.TLSSpec{CheckRevocation: true}})
+			m.HTTPClient = newTLSClient(root)
+			m.CheckSites(context.Background())
+
+			entry, ok := m.GetEntry(testServer.URL)
+			require.True(t, ok)
+			require.NotNil(t, entry.State)
+			assert.Equal(t, tt.up, entry.State.Up, entry.State.LastError)
+			assert.Equal(t, tt.lastError, entry.State.LastError)
+			assert.Equal(t, tt.status, entry.State.Revocation)
+			assert.Equal(t, tt.source, entry.State.RevocationSource)
+			assert.Equal(t, tt.status == monitor.RevocationUnknown, entry.State.RevocationError != "", entry.State.RevocationError)
+			for _, revocationError := range tt.revocationError {
+				assert.Contains(t, entry.State.RevocationError, revocationError)
+			}
+
+			ch := make(chan prometheus.Metric)
+			go func() {
+				m.Collect(ch)
+				close(ch)
+			}()
+			var found bool
+			for metric := range ch {
+				if metrics.MetricName(metric) == "webmon_certificate_revocation_status" {
+					found = true
+					assert.Equal(t, tt.status, metrics.MetricLabel(metric, "status"))
+					assert.Equal(t, tt.source, metrics.MetricLabel(metric, "source"))
+				}
+			}
+			assert.True(t, found)
+		})
+	}
+}
+
+// revocationServer is a stand-in for a CA's OCSP responder and CRL distribution point
+type revocationServer struct {
+	*httptest.Server
+	ca      *testCA
+	revoked map[string]bool
+	expired bool
+	lock    sync.Mutex
+}
+
+func newRevocationServer(t *testing.T, ca *testCA) *revocationServer {
+	t.Helper()
+	server := &revocationServer{ca: ca, revoked: make(map[string]bool)}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var response []byte
+		if req.URL.Path == "/crl" {
+			response = server.crl(t)
+		} else {
+			body, _ := io.ReadAll(req.Body)
+			request, err := ocsp.ParseRequest(body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			response = server.response(t, request.SerialNumber)
+		}
+		_, _ = w.Write(response)
+	}))
+	return server
+}
+
+func (server *revocationServer) revoke(serial *big.Int) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.revoked[serial.String()] = true
+}
+
+// setExpired makes the server return responses & CRLs whose NextUpdate has passed
+func (server *revocationServer) setExpired(expired bool) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.expired = expired
+}
+
+// nextUpdate returns the NextUpdate of the server's responses & CRLs
+func (server *revocationServer) nextUpdate() time.Time {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	if server.expired {
+		return time.Now().Add(-time.Minute)
+	}
+	return time.Now().Add(time.Hour)
+}
+
+func (server *revocationServer) isRevoked(serial *big.Int) bool {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return server.revoked[serial.String()]
+}
+
+// response returns a signed OCSP response for the certificate with the specified serial number
+func (server *revocationServer) response(t *testing.T, serial *big.Int) []byte {
+	template := ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: serial,
+		ThisUpdate:   time.Now().Add(-time.Hour),
+		NextUpdate:   server.nextUpdate(),
+	}
+	if server.isRevoked(serial) {
+		template.Status = ocsp.Revoked
+		template.RevokedAt = time.Now().Add(-time.Minute)
+	}
+	response, err := ocsp.CreateResponse(server.ca.certificate, server.ca.certificate, template, server.ca.key)
+	require.NoError(t, err)
+	return response
+}
+
+// crl returns a CRL listing all revoked certificates
+func (server *revocationServer) crl(t *testing.T) []byte {
+	server.lock.Lock()
+	var revoked []pkix.RevokedCertificate
+	for serial := range server.revoked {
+		number, _ := new(big.Int).SetString(serial, 10)
+		revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: number, RevocationTime: time.Now().Add(-time.Minute)})
+	}
+	server.lock.Unlock()
+
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		RevokedCertificates: revoked,
+		Number:              big.NewInt(1),
+		ThisUpdate:          time.Now().Add(-time.Hour),
+		NextUpdate:          server.nextUpdate(),
+	}, server.ca.certificate, server.ca.key)
+	require.NoError(t, err)
+	return crl
+}
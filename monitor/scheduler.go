@@ -0,0 +1,127 @@
+package monitor
+
+import (
+	"container/heap"
+	"time"
+)
+
+// scheduler keeps track of when each site is next due to be checked. Sites are kept in a min-heap, ordered by their
+// due time, so finding the sites that need to be checked doesn't depend on the number of sites being monitored.
+// A site is only checked once at a time: while its check is in flight, the site isn't due.
+type scheduler struct {
+	queue schedule
+	sites map[string]*scheduledSite
+}
+
+type scheduledSite struct {
+	url      string
+	interval time.Duration
+	due      time.Time
+	index    int
+	// running is set while the site is being checked
+	running bool
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{sites: make(map[string]*scheduledSite)}
+}
+
+// add schedules the site to be checked at the specified time and every interval after that.
+// If the site is already scheduled, its interval and due time are updated.
+func (s *scheduler) add(url string, interval time.Duration, due time.Time) {
+	if site, ok := s.sites[url]; ok {
+		site.interval = interval
+		site.due = due
+		heap.Fix(&s.queue, site.index)
+		return
+	}
+	site := &scheduledSite{url: url, interval: interval, due: due}
+	s.sites[url] = site
+	heap.Push(&s.queue, site)
+}
+
+// setInterval changes the interval of a scheduled site. The site's next check is moved forward if the new interval
+// would cause it to be checked sooner.
+func (s *scheduler) setInterval(url string, interval time.Duration) {
+	site, ok := s.sites[url]
+	if ok == false || site.interval == interval {
+		return
+	}
+	if due := site.due.Add(interval - site.interval); due.Before(site.due) {
+		site.due = due
+		heap.Fix(&s.queue, site.index)
+	}
+	site.interval = interval
+}
+
+// remove unschedules the site
+func (s *scheduler) remove(url string) {
+	if site, ok := s.sites[url]; ok {
+		heap.Remove(&s.queue, site.index)
+		delete(s.sites, url)
+	}
+}
+
+// next returns the time when the next site is due to be checked. If no sites are scheduled, ok is false.
+func (s *scheduler) next() (due time.Time, ok bool) {
+	if len(s.queue) == 0 {
+		return
+	}
+	return s.queue[0].due, true
+}
+
+// popDue returns all sites that are due to be checked at the specified time, marks them as running and reschedules
+// them for their next check. Sites whose previous check is still running skip this check. Call done when a site's
+// check completes.
+func (s *scheduler) popDue(now time.Time) (urls []string) {
+	for len(s.queue) > 0 && s.queue[0].due.After(now) == false {
+		site := s.queue[0]
+		if site.running == false {
+			urls = append(urls, site.url)
+			site.running = true
+		}
+
+		// keep the site's cadence, unless we fell behind by more than one interval
+		site.due = site.due.Add(site.interval)
+		if site.due.After(now) == false {
+			site.due = now.Add(site.interval)
+		}
+		heap.Fix(&s.queue, 0)
+	}
+	return
+}
+
+// done marks the site's check as completed, so the site can be checked again when it's next due
+func (s *scheduler) done(url string) {
+	if site, ok := s.sites[url]; ok {
+		site.running = false
+	}
+}
+
+// schedule implements heap.Interface
+type schedule []*scheduledSite
+
+func (q schedule) Len() int { return len(q) }
+
+func (q schedule) Less(i, j int) bool { return q[i].due.Before(q[j].due) }
+
+func (q schedule) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *schedule) Push(x interface{}) {
+	site := x.(*scheduledSite)
+	site.index = len(*q)
+	*q = append(*q, site)
+}
+
+func (q *schedule) Pop() interface{} {
+	old := *q
+	n := len(old)
+	site := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return site
+}
@@ -0,0 +1,220 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"time"
+)
+
+var (
+	// ErrDuplicateSite is returned by AddSite when the site is already being monitored
+	ErrDuplicateSite = errors.New("site already exists")
+	// ErrSiteNotFound is returned by UpdateSite and RemoveSite when the site is not being monitored
+	ErrSiteNotFound = errors.New("site not found")
+	// ErrInvalidSite is returned by AddSite and UpdateSite when the site's specification is invalid
+	ErrInvalidSite = errors.New("invalid site")
+)
+
+// AddSite adds a site to the monitor. If the monitor is running, the site is checked immediately.
+// It returns ErrDuplicateSite if the site is already being monitored and ErrInvalidSite if the site's specification
+// is not valid. AddSite is safe for concurrent use.
+func (monitor *Monitor) AddSite(site SiteSpec) error {
+	if err := site.Validate(); err != nil {
+		return err
+	}
+
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+
+	if _, ok := monitor.sites[site.URL]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateSite, site.URL)
+	}
+
+	log.WithField("url", site.URL).Info("registering new url")
+	monitor.sites[site.URL] = Entry{Spec: site}
+	if monitor.interval > 0 {
+		// check the new site straight away
+		monitor.schedule.add(site.URL, monitor.siteInterval(site), time.Now())
+		monitor.wakeUp()
+	}
+	return nil
+}
+
+// UpdateSite replaces the specification of a monitored site. The site's last known state is kept.
+// If the specification changed and the monitor is running, the site is checked immediately.
+// It returns ErrSiteNotFound if the site is not being monitored and ErrInvalidSite if the site's specification
+// is not valid. UpdateSite is safe for concurrent use.
+func (monitor *Monitor) UpdateSite(site SiteSpec) error {
+	if err := site.Validate(); err != nil {
+		return err
+	}
+
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+
+	entry, ok := monitor.sites[site.URL]
+	if ok == false {
+		return fmt.Errorf("%w: %s", ErrSiteNotFound, site.URL)
+	}
+
+	changed := reflect.DeepEqual(entry.Spec, site) == false
+	log.WithField("url", site.URL).Debug("updating url")
+	entry.Spec = site
+	monitor.sites[site.URL] = entry
+	if monitor.interval > 0 {
+		if changed {
+			// check the site against its new specification straight away
+			monitor.schedule.add(site.URL, monitor.siteInterval(site), time.Now())
+		} else {
+			monitor.schedule.setInterval(site.URL, monitor.siteInterval(site))
+		}
+		monitor.wakeUp()
+	}
+	return nil
+}
+
+// RemoveSite stops monitoring the site with the specified URL. It returns ErrSiteNotFound if the site is not
+// being monitored. RemoveSite is safe for concurrent use.
+func (monitor *Monitor) RemoveSite(url string) error {
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+
+	if _, ok := monitor.sites[url]; ok == false {
+		return fmt.Errorf("%w: %s", ErrSiteNotFound, url)
+	}
+
+	log.WithField("url", url).Info("unregistering url")
+	delete(monitor.sites, url)
+	monitor.schedule.remove(url)
+	return nil
+}
+
+// Sites returns the specification of all monitored sites, sorted by URL. Sites is safe for concurrent use.
+func (monitor *Monitor) Sites() (sites []SiteSpec) {
+	monitor.lock.RLock()
+	defer monitor.lock.RUnlock()
+
+	sites = make([]SiteSpec, 0, len(monitor.sites))
+	for _, entry := range monitor.sites {
+		sites = append(sites, entry.Spec)
+	}
+	sort.Slice(sites, func(i, j int) bool { return sites[i].URL < sites[j].URL })
+	return
+}
+
+// wakeUp signals Run that the schedule has changed. Never blocks.
+func (monitor *Monitor) wakeUp() {
+	select {
+	case monitor.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// Validate checks that the site's specification is valid. If not, it returns an error wrapping ErrInvalidSite.
+func (site SiteSpec) Validate() error {
+	if err := site.validate(); err != nil {
+		return fmt.Errorf("%w: %s: %s", ErrInvalidSite, site.URL, err)
+	}
+	return nil
+}
+
+func (site SiteSpec) validate() error {
+	target, err := url.Parse(site.URL)
+	if err != nil {
+		return err
+	}
+	if _, ok := checkers[target.Scheme]; ok == false {
+		return fmt.Errorf("unsupported scheme '%s'", target.Scheme)
+	}
+	if target.Port() == "" && needsPort(target.Scheme) {
+		return errors.New("missing port")
+	}
+	if target.Hostname() == "" {
+		return errors.New("missing host")
+	}
+	if site.Interval.Duration < 0 || site.Timeout.Duration < 0 {
+		return errors.New("interval and timeout cannot be negative")
+	}
+	if site.Retries < 0 || site.RetryBackoff.Duration < 0 {
+		return errors.New("retries and retry backoff cannot be negative")
+	}
+	if site.FailureThreshold < 0 || site.SuccessThreshold < 0 {
+		return errors.New("failure and success thresholds cannot be negative")
+	}
+	if err = validateIPFamily(site.IPFamily); err != nil {
+		return err
+	}
+	if site.ResolveTo != "" && net.ParseIP(site.ResolveTo) == nil {
+		return fmt.Errorf("invalid resolve_to address '%s'", site.ResolveTo)
+	}
+	if site.Proxy != nil {
+		if err = site.Proxy.validate(); err != nil {
+			return err
+		}
+		if site.Proxy.enabled() && target.Scheme == "dns" {
+			return errors.New("proxy is not supported for dns sites")
+		}
+		if site.Proxy.enabled() && site.IPFamily != "" {
+			return errors.New("ip_family is not supported for sites checked through a proxy")
+		}
+	}
+	if site.Quorum < 0 {
+		return errors.New("quorum cannot be negative")
+	}
+	if site.AllAddresses && target.Scheme == "dns" {
+		return errors.New("all_addresses is not supported for dns sites")
+	}
+	if _, err = parseStatusCodes(site.StatusCodes); err != nil {
+		return err
+	}
+	if site.Content != nil {
+		for _, expression := range site.Content.Matches {
+			if _, err = regexp.Compile(expression); err != nil {
+				return fmt.Errorf("invalid regular expression \"%s\": %w", expression, err)
+			}
+		}
+	}
+	if target.Scheme == "dns" {
+		if _, err = parseDNSQuery(target); err != nil {
+			return err
+		}
+	}
+	if site.DNS != nil {
+		if err = site.DNS.validate(); err != nil {
+			return err
+		}
+	}
+	if site.WebSocket != nil {
+		if err = site.WebSocket.validate(); err != nil {
+			return err
+		}
+	}
+	if site.TCP != nil {
+		if err = site.TCP.validate(); err != nil {
+			return err
+		}
+	}
+	if site.TLS != nil {
+		if err = site.TLS.validate(); err != nil {
+			return err
+		}
+	}
+	assertions := make(map[string]struct{})
+	for _, assertion := range site.JSON {
+		if err = assertion.validate(); err != nil {
+			return fmt.Errorf("assertion \"%s\": %w", assertion, err)
+		}
+		// assertions are reported by their description, so each description must be unique
+		if _, found := assertions[assertion.String()]; found {
+			return fmt.Errorf("duplicate assertion \"%s\"", assertion)
+		}
+		assertions[assertion.String()] = struct{}{}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package monitor_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/clambin/webmon/monitor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMonitor_Sites(t *testing.T) {
+	m := monitor.New([]string{"https://example.com"})
+
+	err := m.AddSite(monitor.SiteSpec{URL: "https://example.org", Name: "org"})
+	require.NoError(t, err)
+
+	err = m.AddSite(monitor.SiteSpec{URL: "https://example.org"})
+	assert.ErrorIs(t, err, monitor.ErrDuplicateSite)
+
+	err = m.UpdateSite(monitor.SiteSpec{URL: "https://example.org", Name: "example"})
+	require.NoError(t, err)
+
+	err = m.UpdateSite(monitor.SiteSpec{URL: "https://example.net"})
+	assert.ErrorIs(t, err, monitor.ErrSiteNotFound)
+
+	assert.Equal(t, []monitor.SiteSpec{
+		{URL: "https://example.com"},
+		{URL: "https://example.org", Name: "example"},
+	}, m.Sites())
+
+	err = m.RemoveSite("https://example.com")
+	require.NoError(t, err)
+
+	err = m.RemoveSite("https://example.com")
+	assert.ErrorIs(t, err, monitor.ErrSiteNotFound)
+
+	assert.Equal(t, []monitor.SiteSpec{{URL: "https://example.org", Name: "example"}}, m.Sites())
+}
+
+func TestSiteSpec_Validate(t *testing.T) {
+	testCases := []struct {
+		name string
+		site monitor.SiteSpec
+		err  string
+	}{
+		{name: "valid", site: monitor.SiteSpec{URL: "https://example.com"}},
+		{name: "bad url", site: monitor.SiteSpec{URL: "https://example.com:foo"}, err: `invalid site: https://example.com:foo: parse "https://example.com:foo": invalid port ":foo" after host`},
+		{name: "bad scheme", site: monitor.SiteSpec{URL: "ftp://example.com"}, err: `invalid site: ftp://example.com: unsupported scheme 'ftp'`},
+		{name: "missing scheme", site: monitor.SiteSpec{URL: "example.com"}, err: `invalid site: example.com: unsupported scheme ''`},
+		{name: "missing host", site: monitor.SiteSpec{URL: "https:///index.html"}, err: `invalid site: https:///index.html: missing host`},
+		{name: "negative interval", site: monitor.SiteSpec{URL: "https://example.com", Interval: monitor.Duration{Duration: -time.Second}}, err: `invalid site: https://example.com: interval and timeout cannot be negative`},
+		{name: "negative retries", site: monitor.SiteSpec{URL: "https://example.com", Retries: -1}, err: `invalid site: https://example.com: retries and retry backoff cannot be negative`},
+		{name: "negative threshold", site: monitor.SiteSpec{URL: "https://example.com", FailureThreshold: -1}, err: `invalid site: https://example.com: failure and success thresholds cannot be negative`},
+		{name: "client certificate", site: monitor.SiteSpec{URL: "https://example.com", TLS: &monitor.TLSSpec{CertFile: "tls.crt"}}, err: `invalid site: https://example.com: tls: client certificate and key must be specified together`},
+		{name: "tls version", site: monitor.SiteSpec{URL: "https://example.com", TLS: &monitor.TLSSpec{MinVersion: "1.4"}}, err: `invalid site: https://example.com: tls: invalid minimum version '1.4'`},
+		{name: "tls cipher", site: monitor.SiteSpec{URL: "https://example.com", TLS: &monitor.TLSSpec{ForbiddenCiphers: []string{"TLS_NULL"}}}, err: `invalid site: https://example.com: tls: unknown cipher suite 'TLS_NULL'`},
+		{name: "tls fingerprint", site: monitor.SiteSpec{URL: "https://example.com", TLS: &monitor.TLSSpec{Fingerprints: []string{"AB:CD"}}}, err: `invalid site: https://example.com: tls: invalid SHA-256 fingerprint 'AB:CD'`},
+		{name: "tcp", site: monitor.SiteSpec{URL: "tcp://example.com:22", TCP: &monitor.TCPSpec{Expect: "^SSH"}}},
+		{name: "tcp port", site: monitor.SiteSpec{URL: "tcp://example.com"}, err: `invalid site: tcp://example.com: missing port`},
+		{name: "tls", site: monitor.SiteSpec{URL: "tls://example.com:636"}},
+		{name: "tls port", site: monitor.SiteSpec{URL: "tls://example.com"}, err: `invalid site: tls://example.com: missing port`},
+		{name: "starttls", site: monitor.SiteSpec{URL: "smtp+starttls://mail.example.com"}},
+		{name: "starttls port", site: monitor.SiteSpec{URL: "postgres+starttls://db.example.com:6432"}},
+		{name: "dns", site: monitor.SiteSpec{URL: "dns://8.8.8.8/example.com?type=AAAA", DNS: &monitor.DNSSpec{Addresses: []string{"2001:db8::1"}}}},
+		{name: "dns name", site: monitor.SiteSpec{URL: "dns://8.8.8.8"}, err: `invalid site: dns://8.8.8.8: missing name`},
+		{name: "dns type", site: monitor.SiteSpec{URL: "dns://8.8.8.8:5353/example.com?type=PTR"}, err: `invalid site: dns://8.8.8.8:5353/example.com?type=PTR: unsupported query type 'PTR'`},
+		{name: "dns address", site: monitor.SiteSpec{URL: "dns://8.8.8.8/example.com", DNS: &monitor.DNSSpec{Addresses: []string{"example.com"}}}, err: `invalid site: dns://8.8.8.8/example.com: dns: invalid address 'example.com'`},
+		{name: "dns nxdomain", site: monitor.SiteSpec{URL: "dns://8.8.8.8/example.com", DNS: &monitor.DNSSpec{NXDomain: true, CNAME: "example.org"}}, err: `invalid site: dns://8.8.8.8/example.com: dns: nxdomain cannot be combined with other assertions`},
+		{name: "grpc", site: monitor.SiteSpec{URL: "grpcs://example.com:443", GRPC: &monitor.GRPCSpec{Service: "foo.Bar"}}},
+		{name: "grpc port", site: monitor.SiteSpec{URL: "grpc://example.com"}, err: `invalid site: grpc://example.com: missing port`},
+		{name: "all addresses", site: monitor.SiteSpec{URL: "https://example.com", AllAddresses: true, Quorum: 2}},
+		{name: "proxy", site: monitor.SiteSpec{URL: "https://example.com", Proxy: &monitor.ProxySpec{URL: "socks5://proxy.example.com:1080", Username: "user", Password: "secret"}}},
+		{name: "direct", site: monitor.SiteSpec{URL: "https://example.com", Proxy: &monitor.ProxySpec{Direct: true}}},
+		{name: "proxy and direct", site: monitor.SiteSpec{URL: "https://example.com", Proxy: &monitor.ProxySpec{URL: "http://proxy.example.com:3128", Direct: true}}, err: `invalid site: https://example.com: proxy: url and direct are mutually exclusive`},
+		{name: "proxy scheme", site: monitor.SiteSpec{URL: "https://example.com", Proxy: &monitor.ProxySpec{URL: "ftp://proxy.example.com"}}, err: `invalid site: https://example.com: proxy: unsupported scheme 'ftp'`},
+		{name: "proxy host", site: monitor.SiteSpec{URL: "https://example.com", Proxy: &monitor.ProxySpec{URL: "http://:3128"}}, err: `invalid site: https://example.com: proxy: missing host`},
+		{name: "proxy dns", site: monitor.SiteSpec{URL: "dns://192.0.2.53/example.com", Proxy: &monitor.ProxySpec{URL: "http://proxy.example.com:3128"}}, err: `invalid site: dns://192.0.2.53/example.com: proxy is not supported for dns sites`},
+		{name: "proxy ip family", site: monitor.SiteSpec{URL: "https://example.com", IPFamily: monitor.IPFamilyV6, Proxy: &monitor.ProxySpec{URL: "http://proxy.example.com:3128"}}, err: `invalid site: https://example.com: ip_family is not supported for sites checked through a proxy`},
+		{name: "resolve to", site: monitor.SiteSpec{URL: "https://example.com", ResolveTo: "2001:db8::1"}},
+		{name: "invalid resolve to", site: monitor.SiteSpec{URL: "https://example.com", ResolveTo: "example.net"}, err: `invalid site: https://example.com: invalid resolve_to address 'example.net'`},
+		{name: "ip family", site: monitor.SiteSpec{URL: "https://example.com", IPFamily: monitor.IPFamilyBoth}},
+		{name: "invalid ip family", site: monitor.SiteSpec{URL: "https://example.com", IPFamily: "v5"}, err: `invalid site: https://example.com: invalid ip_family 'v5'`},
+		{name: "negative quorum", site: monitor.SiteSpec{URL: "https://example.com", AllAddresses: true, Quorum: -1}, err: `invalid site: https://example.com: quorum cannot be negative`},
+		{name: "all addresses dns", site: monitor.SiteSpec{URL: "dns://192.0.2.53/example.com", AllAddresses: true}, err: `invalid site: dns://192.0.2.53/example.com: all_addresses is not supported for dns sites`},
+		{name: "websocket", site: monitor.SiteSpec{URL: "wss://example.com/ws", WebSocket: &monitor.WebSocketSpec{Send: "ping", Expect: "pong"}}},
+		{name: "websocket expect", site: monitor.SiteSpec{URL: "ws://example.com/ws", WebSocket: &monitor.WebSocketSpec{Expect: "("}}, err: "invalid site: ws://example.com/ws: websocket: invalid regular expression \"(\": error parsing regexp: missing closing ): `(`"},
+		{name: "tcp expect", site: monitor.SiteSpec{URL: "tcp://example.com:22", TCP: &monitor.TCPSpec{Expect: "("}}, err: "invalid site: tcp://example.com:22: invalid regular expression \"(\": error parsing regexp: missing closing ): `(`"},
+		{name: "status codes", site: monitor.SiteSpec{URL: "https://example.com", StatusCodes: "200-foo"}, err: `invalid site: https://example.com: invalid status code '200-foo': strconv.Atoi: parsing "foo": invalid syntax`},
+		{name: "status code range", site: monitor.SiteSpec{URL: "https://example.com", StatusCodes: "299-200"}, err: `invalid site: https://example.com: invalid status code '299-200': range end 200 is lower than range start 299`},
+		{name: "status code", site: monitor.SiteSpec{URL: "https://example.com", StatusCodes: "1000"}, err: `invalid site: https://example.com: invalid status code '1000': 1000 is not a valid HTTP status code`},
+		{name: "content", site: monitor.SiteSpec{URL: "https://example.com", Content: &monitor.ContentSpec{Matches: []string{"("}}}, err: "invalid site: https://example.com: invalid regular expression \"(\": error parsing regexp: missing closing ): `(`"},
+		{name: "json operator", site: monitor.SiteSpec{URL: "https://example.com", JSON: []monitor.JSONAssertion{{Path: "status", Operator: "like", Value: "ok"}}}, err: `invalid site: https://example.com: assertion "status like ok": unknown operator "like"`},
+		{name: "json duplicate", site: monitor.SiteSpec{URL: "https://example.com", JSON: []monitor.JSONAssertion{{Path: "status", Value: "ok"}, {Path: "status", Operator: "eq", Value: "ok"}}}, err: `invalid site: https://example.com: duplicate assertion "status eq ok"`},
+		{name: "json number", site: monitor.SiteSpec{URL: "https://example.com", JSON: []monitor.JSONAssertion{{Path: "uptime", Operator: "gt", Value: "foo"}}}, err: `invalid site: https://example.com: assertion "uptime gt foo": "foo" is not a number`},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.site.Validate()
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, monitor.ErrInvalidSite)
+			assert.EqualError(t, err, tt.err)
+
+			m := monitor.New(nil)
+			assert.ErrorIs(t, m.AddSite(tt.site), monitor.ErrInvalidSite)
+		})
+	}
+}
+
+func TestMonitor_AddSite_Concurrent(t *testing.T) {
+	// a site that keeps all workers busy
+	slow := make(chan struct{})
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-slow
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer slowServer.Close()
+	defer close(slow)
+
+	m := monitor.New(nil)
+	m.MaxConcurrentChecks = 1
+	require.NoError(t, m.AddSite(monitor.SiteSpec{URL: slowServer.URL}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		err := m.Run(ctx, 10*time.Millisecond)
+		require.NoError(t, err)
+	}()
+
+	// add, update & remove sites while the monitor is busy
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			url := fmt.Sprintf("https://%d.example.com", i)
+			assert.NoError(t, m.AddSite(monitor.SiteSpec{URL: url}))
+			assert.NoError(t, m.UpdateSite(monitor.SiteSpec{URL: url, Name: "site"}))
+			_ = m.Sites()
+			if i%2 == 0 {
+				assert.NoError(t, m.RemoveSite(url))
+			}
+		}(i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("site registration blocked while sites were being checked")
+	}
+
+	assert.Len(t, m.Sites(), 6)
+}
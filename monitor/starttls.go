@@ -0,0 +1,170 @@
+package monitor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+)
+
+// A startTLSProtocol upgrades a plaintext connection to TLS
+type startTLSProtocol struct {
+	// port is the protocol's default port, used if the site's URL doesn't specify a port
+	port string
+	// negotiate asks the server to start TLS. Once negotiate returns without error, the TLS handshake can start
+	negotiate func(conn net.Conn) error
+}
+
+// startTLSProtocols contains the supported STARTTLS protocols, by URL scheme
+var startTLSProtocols = map[string]startTLSProtocol{
+	"smtp+starttls":     {port: "25", negotiate: startTLSSMTP},
+	"imap+starttls":     {port: "143", negotiate: startTLSIMAP},
+	"ldap+starttls":     {port: "389", negotiate: startTLSLDAP},
+	"postgres+starttls": {port: "5432", negotiate: startTLSPostgres},
+}
+
+// startTLSSMTP sends STARTTLS to an SMTP server (RFC 3207)
+func startTLSSMTP(conn net.Conn) (err error) {
+	text := textproto.NewConn(conn)
+	if _, _, err = text.ReadResponse(220); err != nil {
+		return err
+	}
+	if err = text.PrintfLine("EHLO webmon"); err == nil {
+		_, _, err = text.ReadResponse(250)
+	}
+	if err == nil {
+		if err = text.PrintfLine("STARTTLS"); err == nil {
+			_, _, err = text.ReadResponse(220)
+		}
+	}
+	return err
+}
+
+// startTLSIMAP sends STARTTLS to an IMAP server (RFC 3501)
+func startTLSIMAP(conn net.Conn) error {
+	text := textproto.NewConn(conn)
+	greeting, err := text.ReadLine()
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(greeting, "* OK") == false {
+		return fmt.Errorf("unexpected greeting: %s", greeting)
+	}
+	if err = text.PrintfLine("a1 STARTTLS"); err != nil {
+		return err
+	}
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, "a1 ") {
+			if strings.HasPrefix(line, "a1 OK") == false {
+				return fmt.Errorf("unexpected response: %s", line)
+			}
+			return nil
+		}
+	}
+}
+
+// ldapStartTLSRequest is an LDAP ExtendedRequest for the StartTLS operation (RFC 4511, section 4.14), with message ID 1
+var ldapStartTLSRequest = append([]byte{
+	0x30, 0x1d, // LDAPMessage
+	0x02, 0x01, 0x01, // messageID
+	0x77, 0x18, // ExtendedRequest
+	0x80, 0x16, // requestName
+}, "1.3.6.1.4.1.1466.20037"...)
+
+// startTLSLDAP sends a StartTLS extended request to an LDAP server
+func startTLSLDAP(conn net.Conn) error {
+	if _, err := conn.Write(ldapStartTLSRequest); err != nil {
+		return err
+	}
+	_, message, err := readBER(conn)
+	if err != nil {
+		return err
+	}
+	// skip the message ID
+	if _, _, message, err = parseBER(message); err != nil {
+		return err
+	}
+	tag, response, _, err := parseBER(message)
+	if err != nil {
+		return err
+	}
+	if tag != 0x78 {
+		return fmt.Errorf("unexpected LDAP response 0x%02x", tag)
+	}
+	tag, resultCode, _, err := parseBER(response)
+	if err != nil {
+		return err
+	}
+	if tag != 0x0a || len(resultCode) != 1 {
+		return errors.New("invalid LDAP result code")
+	}
+	if resultCode[0] != 0 {
+		return fmt.Errorf("LDAP result code %d", resultCode[0])
+	}
+	return nil
+}
+
+// maxLDAPResponseSize is the maximum size of the LDAP server's response to the StartTLS request
+const maxLDAPResponseSize = 4096
+
+// readBER reads one BER-encoded element from r
+func readBER(r io.Reader) (tag byte, value []byte, err error) {
+	header := make([]byte, 2)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return
+	}
+	tag, size := header[0], int(header[1])
+	if size&0x80 != 0 {
+		lengthBytes := make([]byte, size&0x7f)
+		if len(lengthBytes) == 0 || len(lengthBytes) > 3 {
+			return 0, nil, errors.New("unsupported BER length")
+		}
+		if _, err = io.ReadFull(r, lengthBytes); err != nil {
+			return
+		}
+		size = 0
+		for _, b := range lengthBytes {
+			size = size<<8 | int(b)
+		}
+	}
+	if size > maxLDAPResponseSize {
+		return 0, nil, errors.New("LDAP response too large")
+	}
+	value = make([]byte, size)
+	_, err = io.ReadFull(r, value)
+	return
+}
+
+// parseBER parses the first BER-encoded element in data and returns the remaining data
+func parseBER(data []byte) (tag byte, value, rest []byte, err error) {
+	reader := bytes.NewReader(data)
+	if tag, value, err = readBER(reader); err != nil {
+		return 0, nil, nil, errors.New("invalid LDAP response")
+	}
+	return tag, value, data[len(data)-reader.Len():], nil
+}
+
+// postgresSSLRequest is the SSLRequest message of the PostgreSQL protocol
+var postgresSSLRequest = []byte{0x00, 0x00, 0x00, 0x08, 0x04, 0xd2, 0x16, 0x2f}
+
+// startTLSPostgres sends an SSLRequest to a PostgreSQL server
+func startTLSPostgres(conn net.Conn) error {
+	if _, err := conn.Write(postgresSSLRequest); err != nil {
+		return err
+	}
+	response := make([]byte, 1)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return err
+	}
+	if response[0] != 'S' {
+		return errors.New("server does not support SSL")
+	}
+	return nil
+}
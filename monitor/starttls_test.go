@@ -0,0 +1,127 @@
+package monitor_test
+
+import (
+	"context"
+	"errors"
+	"github.com/clambin/webmon/monitor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"net/textproto"
+	"testing"
+	"time"
+)
+
+func TestMonitor_CheckSites_StartTLS(t *testing.T) {
+	root := newTestCA(t, "root", nil, 10*365*24*time.Hour)
+	certificate := root.issue(t, 30*24*time.Hour, "localhost", "127.0.0.1")
+
+	testCases := []struct {
+		name      string
+		scheme    string
+		negotiate func(conn net.Conn) error
+		up        bool
+		lastError string
+	}{
+		{name: "smtp", scheme: "smtp+starttls", negotiate: smtpServer(true), up: true},
+		{name: "smtp - not supported", scheme: "smtp+starttls", negotiate: smtpServer(false), lastError: `starttls: 502 "STARTTLS not supported"`},
+		{name: "imap", scheme: "imap+starttls", negotiate: imapServer(true), up: true},
+		{name: "imap - not supported", scheme: "imap+starttls", negotiate: imapServer(false), lastError: "starttls: unexpected response: a1 BAD STARTTLS not supported"},
+		{name: "ldap", scheme: "ldap+starttls", negotiate: ldapServer(0), up: true},
+		{name: "ldap - not supported", scheme: "ldap+starttls", negotiate: ldapServer(2), lastError: "starttls: LDAP result code 2"},
+		{name: "postgres", scheme: "postgres+starttls", negotiate: postgresServer('S'), up: true},
+		{name: "postgres - not supported", scheme: "postgres+starttls", negotiate: postgresServer('N'), lastError: "starttls: server does not support SSL"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			listener := newTLSEndpoint(t, certificate, tt.negotiate)
+			defer func() { _ = listener.Close() }()
+			url := tt.scheme + "://" + listener.Addr().String()
+
+			m := newMonitor(t, monitor.SiteSpec{URL: url, Timeout: monitor.Duration{Duration: time.Second}})
+			m.HTTPClient = newTLSClient(root)
+			m.CheckSites(context.Background())
+
+			entry, ok := m.GetEntry(url)
+			require.True(t, ok)
+			require.NotNil(t, entry.State)
+			assert.Equal(t, tt.up, entry.State.Up)
+			assert.Equal(t, tt.lastError, entry.State.LastError)
+			assert.Equal(t, tt.up, entry.State.IsTLS)
+			if tt.up {
+				require.Len(t, entry.State.Certificates, 1)
+				assert.Equal(t, "CN=localhost", entry.State.Certificates[0].Subject)
+				assert.Equal(t, monitor.TLSVerificationOK, entry.State.TLSVerification)
+			}
+		})
+	}
+}
+
+func smtpServer(startTLS bool) func(conn net.Conn) error {
+	return func(conn net.Conn) error {
+		text := textproto.NewConn(conn)
+		_ = text.PrintfLine("220 mail.example.com ESMTP")
+		if _, err := text.ReadLine(); err != nil {
+			return err
+		}
+		_ = text.PrintfLine("250-mail.example.com\r\n250 SIZE 1000000")
+		if _, err := text.ReadLine(); err != nil {
+			return err
+		}
+		if startTLS == false {
+			_ = text.PrintfLine("502 STARTTLS not supported")
+			return errors.New("not supported")
+		}
+		return text.PrintfLine("220 ready to start TLS")
+	}
+}
+
+func imapServer(startTLS bool) func(conn net.Conn) error {
+	return func(conn net.Conn) error {
+		text := textproto.NewConn(conn)
+		_ = text.PrintfLine("* OK IMAP4rev1 server ready")
+		if _, err := text.ReadLine(); err != nil {
+			return err
+		}
+		if startTLS == false {
+			_ = text.PrintfLine("a1 BAD STARTTLS not supported")
+			return errors.New("not supported")
+		}
+		_ = text.PrintfLine("* informational message")
+		return text.PrintfLine("a1 OK begin TLS negotiation now")
+	}
+}
+
+func ldapServer(resultCode byte) func(conn net.Conn) error {
+	return func(conn net.Conn) error {
+		request := make([]byte, 31)
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return err
+		}
+		if string(request[9:]) != "1.3.6.1.4.1.1466.20037" {
+			return errors.New("not a StartTLS request")
+		}
+		// ExtendedResponse with the result code, an empty matchedDN and an empty diagnosticMessage
+		_, _ = conn.Write([]byte{0x30, 0x0c, 0x02, 0x01, 0x01, 0x78, 0x07, 0x0a, 0x01, resultCode, 0x04, 0x00, 0x04, 0x00})
+		if resultCode != 0 {
+			return errors.New("not supported")
+		}
+		return nil
+	}
+}
+
+func postgresServer(response byte) func(conn net.Conn) error {
+	return func(conn net.Conn) error {
+		request := make([]byte, 8)
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return err
+		}
+		_, _ = conn.Write([]byte{response})
+		if response != 'S' {
+			return errors.New("not supported")
+		}
+		return nil
+	}
+}
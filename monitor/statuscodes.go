@@ -0,0 +1,85 @@
+package monitor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultStatusCodes lists the HTTP status codes that indicate a site is up, if the site's SiteSpec doesn't specify any
+const DefaultStatusCodes = "200,401,307,302"
+
+// statusCodes holds the parsed list of HTTP status codes & ranges that are accepted for a site
+type statusCodes []statusCodeRange
+
+type statusCodeRange struct {
+	from int
+	to   int
+}
+
+// parseStatusCodes parses a comma-separated list of HTTP status codes and ranges, e.g. "200-299,401".
+// An empty list returns the default status codes, i.e. DefaultStatusCodes
+func parseStatusCodes(input string) (codes statusCodes, err error) {
+	if strings.TrimSpace(input) == "" {
+		input = DefaultStatusCodes
+	}
+
+	for _, field := range strings.Split(input, ",") {
+		var codeRange statusCodeRange
+		codeRange, err = parseStatusCodeRange(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code '%s': %w", field, err)
+		}
+		codes = append(codes, codeRange)
+	}
+	return
+}
+
+func parseStatusCodeRange(field string) (codeRange statusCodeRange, err error) {
+	limits := strings.SplitN(field, "-", 2)
+
+	codeRange.from, err = parseStatusCode(limits[0])
+	if err != nil {
+		return
+	}
+
+	codeRange.to = codeRange.from
+	if len(limits) == 2 {
+		codeRange.to, err = parseStatusCode(limits[1])
+		if err == nil && codeRange.to < codeRange.from {
+			err = fmt.Errorf("range end %d is lower than range start %d", codeRange.to, codeRange.from)
+		}
+	}
+	return
+}
+
+func parseStatusCode(field string) (code int, err error) {
+	code, err = strconv.Atoi(strings.TrimSpace(field))
+	if err == nil && (code < 100 || code > 599) {
+		err = fmt.Errorf("%d is not a valid HTTP status code", code)
+	}
+	return
+}
+
+// match returns true if the statusCode is part of the list
+func (codes statusCodes) match(statusCode int) bool {
+	for _, codeRange := range codes {
+		if statusCode >= codeRange.from && statusCode <= codeRange.to {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the list in the same format as accepted by parseStatusCodes
+func (codes statusCodes) String() string {
+	fields := make([]string, 0, len(codes))
+	for _, codeRange := range codes {
+		if codeRange.from == codeRange.to {
+			fields = append(fields, strconv.Itoa(codeRange.from))
+		} else {
+			fields = append(fields, strconv.Itoa(codeRange.from)+"-"+strconv.Itoa(codeRange.to))
+		}
+	}
+	return strings.Join(fields, ",")
+}
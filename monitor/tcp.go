@@ -0,0 +1,93 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// maxBannerSize is the maximum number of bytes read from a TCP site when matching TCPSpec.Expect
+const maxBannerSize = 4096
+
+// A TCPSpec specifies how a TCP site (tcp://host:port) is checked. The site is up if a connection can be set up and,
+// if specified, the site's response matches Expect.
+type TCPSpec struct {
+	// Send is written to the connection once it's set up
+	Send string `json:"send,omitempty"`
+	// Expect is a regular expression that the site's response (e.g. its banner) must match
+	Expect string `json:"expect,omitempty"`
+}
+
+func (spec *TCPSpec) validate() error {
+	if _, err := regexp.Compile(spec.Expect); err != nil {
+		return fmt.Errorf("invalid regular expression \"%s\": %w", spec.Expect, err)
+	}
+	return nil
+}
+
+// checkTCP checks a TCP site. The site's latency is the time it took to set up the connection.
+func (monitor *Monitor) checkTCP(ctx context.Context, site SiteSpec) (state *SiteState) {
+	state = &SiteState{}
+	target, err := url.Parse(site.URL)
+	if err != nil {
+		state.LastError = err.Error()
+		return
+	}
+
+	start := time.Now()
+	conn, err := dialSite(ctx, site, target.Host)
+	if err != nil {
+		state.setConnectionError(err)
+		return
+	}
+	state.Latency = Duration{Duration: time.Since(start)}
+	defer func() { _ = conn.Close() }()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if err = exchange(conn, site.TCP); err != nil {
+		state.LastError = err.Error()
+		return
+	}
+
+	state.Up = true
+	return
+}
+
+// exchange sends the TCPSpec's Send string and waits for a response that matches its Expect regular expression
+func exchange(conn net.Conn, spec *TCPSpec) (err error) {
+	if spec == nil {
+		return nil
+	}
+	if spec.Send != "" {
+		if _, err = conn.Write([]byte(spec.Send)); err != nil {
+			return fmt.Errorf("send: %w", err)
+		}
+	}
+	if spec.Expect == "" {
+		return nil
+	}
+
+	expect, err := regexp.Compile(spec.Expect)
+	if err != nil {
+		return fmt.Errorf("invalid regular expression \"%s\": %w", spec.Expect, err)
+	}
+	var response bytes.Buffer
+	buf := make([]byte, maxBannerSize)
+	for response.Len() < maxBannerSize {
+		n, readErr := conn.Read(buf[:maxBannerSize-response.Len()])
+		response.Write(buf[:n])
+		if expect.Match(response.Bytes()) {
+			return nil
+		}
+		if readErr != nil {
+			break
+		}
+	}
+	return fmt.Errorf("response %q does not match \"%s\"", response.String(), spec.Expect)
+}
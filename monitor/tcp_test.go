@@ -0,0 +1,103 @@
+package monitor_test
+
+import (
+	"bufio"
+	"context"
+	"github.com/clambin/webmon/monitor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMonitor_CheckSites_TCP(t *testing.T) {
+	// server sends a banner and echoes back each line in uppercase
+	listener := newTCPServer(t, func(conn net.Conn) {
+		_, _ = conn.Write([]byte("SSH-2.0-OpenSSH_8.9\r\n"))
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			_, _ = conn.Write([]byte(strings.ToUpper(scanner.Text()) + "\n"))
+		}
+	})
+	defer func() { _ = listener.Close() }()
+	url := "tcp://" + listener.Addr().String()
+
+	closed := newTCPServer(t, nil)
+	closedURL := "tcp://" + closed.Addr().String()
+	_ = closed.Close()
+
+	testCases := []struct {
+		name      string
+		url       string
+		tcp       *monitor.TCPSpec
+		up        bool
+		lastError string
+	}{
+		{name: "connect", url: url, up: true},
+		{name: "banner", url: url, tcp: &monitor.TCPSpec{Expect: `^SSH-2\.0-`}, up: true},
+		{name: "banner - fail", url: url, tcp: &monitor.TCPSpec{Expect: `^220 `}, up: false, lastError: `response "SSH-2.0-OpenSSH_8.9\r\n" does not match "^220 "`},
+		{name: "send", url: url, tcp: &monitor.TCPSpec{Send: "ping\n", Expect: `PING`}, up: true},
+		{name: "closed", url: closedURL, up: false, lastError: "connection refused"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMonitor(t, monitor.SiteSpec{URL: tt.url, TCP: tt.tcp, Timeout: monitor.Duration{Duration: 500 * time.Millisecond}})
+			m.CheckSites(context.Background())
+
+			entry, ok := m.GetEntry(tt.url)
+			require.True(t, ok)
+			require.NotNil(t, entry.State)
+			assert.Equal(t, tt.up, entry.State.Up)
+			assert.Contains(t, entry.State.LastError, tt.lastError)
+			if tt.up {
+				assert.NotZero(t, entry.State.Latency.Duration)
+			}
+			assert.False(t, entry.State.IsTLS)
+		})
+	}
+}
+
+func TestMonitor_CheckSites_TCP_Timeout(t *testing.T) {
+	// server never responds
+	listener := newTCPServer(t, func(conn net.Conn) {
+		_, _ = bufio.NewReader(conn).ReadString('\n')
+	})
+	defer func() { _ = listener.Close() }()
+	url := "tcp://" + listener.Addr().String()
+
+	m := newMonitor(t, monitor.SiteSpec{URL: url, TCP: &monitor.TCPSpec{Expect: "220"}, Timeout: monitor.Duration{Duration: 100 * time.Millisecond}})
+	start := time.Now()
+	m.CheckSites(context.Background())
+	assert.Less(t, time.Since(start), time.Second)
+
+	entry, ok := m.GetEntry(url)
+	require.True(t, ok)
+	require.NotNil(t, entry.State)
+	assert.False(t, entry.State.Up)
+	assert.Equal(t, `response "" does not match "220"`, entry.State.LastError)
+}
+
+// newTCPServer starts a TCP server on a random local port. Each connection is passed to handle and closed afterwards.
+func newTCPServer(t *testing.T, handle func(conn net.Conn)) net.Listener {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				if handle != nil {
+					handle(conn)
+				}
+				_ = conn.Close()
+			}()
+		}
+	}()
+	return listener
+}
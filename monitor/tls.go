@@ -0,0 +1,274 @@
+package monitor
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Results of a site's TLS certificate verification. See SiteState.TLSVerification
+const (
+	TLSVerificationOK               = "ok"
+	TLSVerificationExpired          = "expired"
+	TLSVerificationHostnameMismatch = "hostname_mismatch"
+	TLSVerificationUnknownAuthority = "unknown_authority"
+	TLSVerificationInvalid          = "invalid"
+)
+
+// A TLSSpec specifies how a site's TLS connection is set up and checked
+type TLSSpec struct {
+	// DeferVerification performs the TLS handshake without verifying the site's certificate. The certificate chain
+	// is verified after the check and the result is reported in SiteState.TLSVerification. A certificate that fails
+	// verification does not mark the site as down
+	DeferVerification bool `json:"defer_verification,omitempty"`
+	// CAFile is the name of a file containing the PEM-encoded CA certificates used to verify the site's certificate,
+	// instead of the system's CA certificates. The file is read on every check, so rotated certificates are picked up
+	CAFile string `json:"ca_file,omitempty"`
+	// CA contains PEM-encoded CA certificates (e.g. obtained from a Kubernetes Secret). Takes precedence over CAFile
+	CA string `json:"-"`
+	// CertFile and KeyFile are the names of the files containing the PEM-encoded client certificate and key used
+	// for mutual TLS. The files are read on every check, so rotated certificates are picked up
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+	// Cert and Key contain the PEM-encoded client certificate and key (e.g. obtained from a Kubernetes Secret).
+	// They take precedence over CertFile and KeyFile and are never included in the JSON representation of a site
+	Cert string `json:"-"`
+	Key  string `json:"-"`
+	// MinVersion is the minimum TLS version that the site must negotiate: "1.0", "1.1", "1.2" or "1.3".
+	// If the site negotiates a lower version, the site is reported as down
+	MinVersion string `json:"min_version,omitempty"`
+	// ForbiddenCiphers lists the cipher suites that the site may not negotiate, e.g. "TLS_RSA_WITH_AES_128_CBC_SHA".
+	// If the site negotiates one of these cipher suites, the site is reported as down.
+	// Sites are checked with all TLS versions and cipher suites that crypto/tls supports (including insecure ones), so
+	// the version and cipher suite that the site negotiates can be checked and reported. If the monitor's HTTPClient
+	// is replaced, sites that don't set MinVersion or ForbiddenCiphers use the TLS versions & cipher suites configured
+	// in its transport
+	ForbiddenCiphers []string `json:"forbidden_ciphers,omitempty"`
+	// Fingerprints pins the site's certificate: if set, the SHA-256 fingerprint of the site's certificate must match
+	// one of these fingerprints (in hexadecimal, with or without colons). Otherwise, the site is reported as down
+	Fingerprints []string `json:"fingerprints,omitempty"`
+	// IssuerCN pins the issuer of the site's certificate: if set, the common name of the certificate's issuer must
+	// match. Otherwise, the site is reported as down
+	IssuerCN string `json:"issuer_cn,omitempty"`
+	// CheckRevocation checks if the site's certificate has been revoked, using the OCSP response stapled by the site,
+	// the certificate's OCSP responders or its CRL distribution points. A revoked certificate marks the site as down
+	CheckRevocation bool `json:"check_revocation,omitempty"`
+}
+
+// custom returns true if the site needs its own TLS configuration
+func (spec *TLSSpec) custom() bool {
+	return spec != nil && (spec.DeferVerification || spec.hasCA() || spec.hasCertificate() || spec.hasVersionPolicy())
+}
+
+func (spec *TLSSpec) hasCA() bool {
+	return spec.CA != "" || spec.CAFile != ""
+}
+
+func (spec *TLSSpec) hasCertificate() bool {
+	return spec.Cert != "" || spec.CertFile != "" || spec.Key != "" || spec.KeyFile != ""
+}
+
+func (spec *TLSSpec) validate() error {
+	if (spec.Cert != "" || spec.CertFile != "") != (spec.Key != "" || spec.KeyFile != "") {
+		return errors.New("tls: client certificate and key must be specified together")
+	}
+	return spec.validatePolicy()
+}
+
+// config returns the site's TLS configuration, based on the monitor's TLS configuration
+func (spec *TLSSpec) config(base *tls.Config) (config *tls.Config, err error) {
+	if base != nil {
+		config = base.Clone()
+	} else {
+		config = &tls.Config{}
+		allowLegacy(config)
+	}
+	config.InsecureSkipVerify = config.InsecureSkipVerify || spec.DeferVerification
+	if spec.hasVersionPolicy() {
+		allowLegacy(config)
+	}
+
+	if spec.hasCA() {
+		var ca []byte
+		if ca, err = loadPEM(spec.CA, spec.CAFile); err != nil {
+			return nil, fmt.Errorf("ca: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if config.RootCAs.AppendCertsFromPEM(ca) == false {
+			return nil, errors.New("ca: no valid certificates found")
+		}
+	}
+
+	if spec.hasCertificate() {
+		var cert, key []byte
+		if cert, err = loadPEM(spec.Cert, spec.CertFile); err != nil {
+			return nil, fmt.Errorf("client certificate: %w", err)
+		}
+		if key, err = loadPEM(spec.Key, spec.KeyFile); err != nil {
+			return nil, fmt.Errorf("client key: %w", err)
+		}
+		var certificate tls.Certificate
+		if certificate, err = tls.X509KeyPair(cert, key); err != nil {
+			return nil, fmt.Errorf("client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
+
+// loadPEM returns the PEM-encoded content, or the content of the file if no content is specified
+func loadPEM(content, filename string) ([]byte, error) {
+	if content != "" {
+		return []byte(content), nil
+	}
+	return os.ReadFile(filename)
+}
+
+// siteClient returns the http.Client used to check the site and the TLS configuration used to verify the site's
+// certificate. Sites that need their own TLS configuration or proxy, or whose connections are pinned to an address or
+// an IP family, get a client with a dedicated transport, cloned from the monitor's HTTPClient. Call release to close
+// the dedicated transport's connections when the check is done.
+func (monitor *Monitor) siteClient(site SiteSpec) (client *http.Client, tlsConfig *tls.Config, release func(), err error) {
+	client, release = monitor.HTTPClient, func() {}
+	base := monitor.baseTransport()
+	if base != nil {
+		tlsConfig = base.TLSClientConfig
+	}
+	pinned := site.AllAddresses || site.IPFamily != "" || site.ResolveTo != ""
+	if base == nil || (site.TLS.custom() == false && pinned == false && site.Proxy == nil) {
+		return
+	}
+
+	transport := base.Clone()
+	if site.TLS.custom() {
+		if transport.TLSClientConfig, err = site.TLS.config(transport.TLSClientConfig); err != nil {
+			return
+		}
+	}
+	if site.Proxy != nil {
+		// the site's proxy replaces any proxy configured in the environment
+		transport.Proxy = nil
+	}
+	tunnel := site.Proxy.enabled()
+	if forwarded(site) {
+		transport.Proxy = site.Proxy.forwardURL
+		transport.DisableKeepAlives = true
+		tunnel = false
+	}
+	if pinned || tunnel {
+		// connections can't be reused across checks, as each check may be pinned to a different address or IP family
+		transport.DisableKeepAlives = true
+		dial := transport.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{}).DialContext
+		}
+		transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			if tunnel {
+				return site.Proxy.dial(ctx, dialAddress(ctx, address))
+			}
+			return dial(ctx, dialNetwork(ctx, network), dialAddress(ctx, address))
+		}
+	}
+
+	siteClient := *monitor.HTTPClient
+	siteClient.Transport = transport
+	return &siteClient, transport.TLSClientConfig, transport.CloseIdleConnections, nil
+}
+
+// siteTLSConfig returns the TLS configuration used to check a site without the monitor's HTTPClient (e.g. a tls://
+// site), based on the TLS configuration of the HTTPClient's transport
+func (monitor *Monitor) siteTLSConfig(site SiteSpec) (*tls.Config, error) {
+	var base *tls.Config
+	if transport := monitor.baseTransport(); transport != nil {
+		base = transport.TLSClientConfig
+	}
+	if site.TLS != nil {
+		return site.TLS.config(base)
+	}
+	if base != nil {
+		return base.Clone(), nil
+	}
+	config := &tls.Config{}
+	allowLegacy(config)
+	return config, nil
+}
+
+// baseTransport returns the monitor's HTTPClient transport, or nil if the transport can't be customized per site
+func (monitor *Monitor) baseTransport() *http.Transport {
+	switch transport := monitor.HTTPClient.Transport.(type) {
+	case nil:
+		return http.DefaultTransport.(*http.Transport)
+	case *http.Transport:
+		return transport
+	default:
+		return nil
+	}
+}
+
+// verifyChain verifies the certificate chain presented by a site for the specified hostname. It returns the result
+// of the verification and, if the verification failed, the reason why.
+func verifyChain(certificates []*x509.Certificate, tlsConfig *tls.Config, hostname string, now time.Time) (result string, err error) {
+	if len(certificates) == 0 {
+		return TLSVerificationInvalid, errors.New("no certificates presented")
+	}
+	options := x509.VerifyOptions{
+		DNSName:       hostname,
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   now,
+	}
+	if tlsConfig != nil {
+		options.Roots = tlsConfig.RootCAs
+		if tlsConfig.ServerName != "" {
+			options.DNSName = tlsConfig.ServerName
+		}
+	}
+	for _, certificate := range certificates[1:] {
+		options.Intermediates.AddCert(certificate)
+	}
+	if _, err = certificates[0].Verify(options); err != nil {
+		return verificationResult(err), err
+	}
+	return TLSVerificationOK, nil
+}
+
+// setConnectionError records why the connection to the site failed. If the connection couldn't be tunnelled through
+// (or the request forwarded by) the site's proxy, the reason is also reported in ProxyError. If the site's certificate failed verification, the
+// reason is also reported in TLSVerification.
+func (state *SiteState) setConnectionError(err error) {
+	state.LastError = err.Error()
+	if proxyErr, ok := asProxyError(err); ok {
+		state.LastError, state.ProxyError = proxyErr.Error(), proxyErr.err.Error()
+		return
+	}
+	if result := verificationResult(err); result != "" {
+		state.TLSVerification, state.TLSVerificationError = result, err.Error()
+	}
+}
+
+// verificationResult returns the result of a failed TLS verification, or blank if err isn't a verification error
+func verificationResult(err error) string {
+	var (
+		invalid   x509.CertificateInvalidError
+		hostname  x509.HostnameError
+		authority x509.UnknownAuthorityError
+	)
+	switch {
+	case errors.As(err, &invalid):
+		if invalid.Reason == x509.Expired {
+			return TLSVerificationExpired
+		}
+		return TLSVerificationInvalid
+	case errors.As(err, &hostname):
+		return TLSVerificationHostnameMismatch
+	case errors.As(err, &authority):
+		return TLSVerificationUnknownAuthority
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,223 @@
+package monitor_test
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"github.com/clambin/gotools/metrics"
+	"github.com/clambin/webmon/monitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMonitor_CheckSites_TLSVerification(t *testing.T) {
+	root := newTestCA(t, "Test Root CA", nil, 365*24*time.Hour)
+	other := newTestCA(t, "Other Root CA", nil, 365*24*time.Hour)
+
+	testCases := []struct {
+		name      string
+		hosts     []string
+		validity  time.Duration
+		trusted   *testCA
+		deferred  bool
+		up        bool
+		result    string
+		inspected bool
+	}{
+		{name: "valid", hosts: []string{"127.0.0.1"}, validity: 24 * time.Hour, trusted: root, up: true, result: monitor.TLSVerificationOK, inspected: true},
+		{name: "valid - deferred", hosts: []string{"127.0.0.1"}, validity: 24 * time.Hour, trusted: root, deferred: true, up: true, result: monitor.TLSVerificationOK, inspected: true},
+		{name: "expired", hosts: []string{"127.0.0.1"}, validity: -24 * time.Hour, trusted: root, up: false, result: monitor.TLSVerificationExpired},
+		{name: "expired - deferred", hosts: []string{"127.0.0.1"}, validity: -24 * time.Hour, trusted: root, deferred: true, up: true, result: monitor.TLSVerificationExpired, inspected: true},
+		{name: "hostname", hosts: []string{"example.com"}, validity: 24 * time.Hour, trusted: root, up: false, result: monitor.TLSVerificationHostnameMismatch},
+		{name: "hostname - deferred", hosts: []string{"example.com"}, validity: 24 * time.Hour, trusted: root, deferred: true, up: true, result: monitor.TLSVerificationHostnameMismatch, inspected: true},
+		{name: "authority", hosts: []string{"127.0.0.1"}, validity: 24 * time.Hour, trusted: other, up: false, result: monitor.TLSVerificationUnknownAuthority},
+		{name: "authority - deferred", hosts: []string{"127.0.0.1"}, validity: 24 * time.Hour, trusted: other, deferred: true, up: true, result: monitor.TLSVerificationUnknownAuthority, inspected: true},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			testServer := newTLSServer(t, root.issue(t, tt.validity, tt.hosts...))
+			defer testServer.Close()
+
+			site := monitor.SiteSpec{URL: testServer.URL}
+			if tt.deferred {
+				site.TLS = &monitor.TLSSpec{DeferVerification: true}
+			}
+			m := newMonitor(t, site)
+			m.HTTPClient = newTLSClient(tt.trusted)
+			m.CheckSites(context.Background())
+
+			entry, ok := m.GetEntry(testServer.URL)
+			require.True(t, ok)
+			require.NotNil(t, entry.State)
+			assert.Equal(t, tt.up, entry.State.Up, entry.State.LastError)
+			assert.Equal(t, tt.result, entry.State.TLSVerification)
+			assert.Equal(t, tt.result == monitor.TLSVerificationOK, entry.State.TLSVerificationError == "")
+			assert.Equal(t, tt.inspected, entry.State.IsTLS)
+			if tt.inspected {
+				require.Len(t, entry.State.Certificates, 1)
+				assert.Equal(t, tt.validity < 0, entry.State.CertificateAge < 0)
+			}
+
+			ch := make(chan prometheus.Metric)
+			go func() {
+				m.Collect(ch)
+				close(ch)
+			}()
+			var found bool
+			for metric := range ch {
+				if metrics.MetricName(metric) == "webmon_certificate_valid" {
+					found = true
+					valid := tt.result == monitor.TLSVerificationOK
+					assert.Equal(t, valid, metrics.MetricValue(metric).GetGauge().GetValue() == 1.0)
+					if valid == false {
+						assert.Equal(t, tt.result, metrics.MetricLabel(metric, "reason"))
+					}
+				}
+			}
+			assert.True(t, found)
+		})
+	}
+}
+
+func TestMonitor_CheckSites_TLSVerification_HTTP(t *testing.T) {
+	stub := &serverStub{}
+	testServer := httptest.NewServer(http.HandlerFunc(stub.Handle))
+	defer testServer.Close()
+
+	m := newMonitor(t, monitor.SiteSpec{URL: testServer.URL, TLS: &monitor.TLSSpec{DeferVerification: true}})
+	m.CheckSites(context.Background())
+
+	entry, ok := m.GetEntry(testServer.URL)
+	require.True(t, ok)
+	require.NotNil(t, entry.State)
+	assert.True(t, entry.State.Up)
+	assert.Empty(t, entry.State.TLSVerification)
+	assert.Equal(t, http.StatusOK, entry.State.HTTPCode)
+}
+
+func TestMonitor_CheckSites_TLS_CA(t *testing.T) {
+	root := newTestCA(t, "Test Root CA", nil, 365*24*time.Hour)
+	other := newTestCA(t, "Other Root CA", nil, 365*24*time.Hour)
+	testServer := newTLSServer(t, root.issue(t, 24*time.Hour, "127.0.0.1"))
+	defer testServer.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, []byte(root.pem()), 0600))
+
+	m := newMonitor(t, monitor.SiteSpec{URL: testServer.URL, TLS: &monitor.TLSSpec{CAFile: caFile}})
+
+	for _, step := range []struct {
+		ca     string
+		up     bool
+		result string
+	}{
+		{ca: root.pem(), up: true, result: monitor.TLSVerificationOK},
+		// rotated CA bundles are picked up on the next check
+		{ca: other.pem(), up: false, result: monitor.TLSVerificationUnknownAuthority},
+		{ca: root.pem() + other.pem(), up: true, result: monitor.TLSVerificationOK},
+		{ca: "not a certificate", up: false},
+	} {
+		require.NoError(t, os.WriteFile(caFile, []byte(step.ca), 0600))
+		m.CheckSites(context.Background())
+
+		entry, ok := m.GetEntry(testServer.URL)
+		require.True(t, ok)
+		require.NotNil(t, entry.State)
+		assert.Equal(t, step.up, entry.State.Up, entry.State.LastError)
+		assert.Equal(t, step.result, entry.State.TLSVerification)
+	}
+
+	entry, _ := m.GetEntry(testServer.URL)
+	assert.Equal(t, "invalid TLS configuration: ca: no valid certificates found", entry.State.LastError)
+}
+
+func TestMonitor_CheckSites_TLS_ClientCertificate(t *testing.T) {
+	root := newTestCA(t, "Test Root CA", nil, 365*24*time.Hour)
+	clientCA := newTestCA(t, "Client CA", nil, 365*24*time.Hour)
+
+	stub := &serverStub{}
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(stub.Handle))
+	testServer.TLS = &tls.Config{
+		Certificates: []tls.Certificate{root.issue(t, 24*time.Hour, "127.0.0.1")},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCA.pool(),
+	}
+	testServer.StartTLS()
+	defer testServer.Close()
+
+	cert, key := encodePEM(t, clientCA.issue(t, 24*time.Hour, "webmon"))
+	otherCert, otherKey := encodePEM(t, root.issue(t, 24*time.Hour, "webmon"))
+
+	testCases := []struct {
+		name string
+		tls  *monitor.TLSSpec
+		up   bool
+	}{
+		{name: "none", tls: &monitor.TLSSpec{CA: root.pem()}, up: false},
+		{name: "valid", tls: &monitor.TLSSpec{CA: root.pem(), Cert: cert, Key: key}, up: true},
+		{name: "untrusted", tls: &monitor.TLSSpec{CA: root.pem(), Cert: otherCert, Key: otherKey}, up: false},
+		{name: "mismatch", tls: &monitor.TLSSpec{CA: root.pem(), Cert: cert, Key: otherKey}, up: false},
+	}
+
+	// secret material is never included in the site's JSON representation
+	out, err := json.Marshal(testCases[1].tls)
+	require.NoError(t, err)
+	assert.Equal(t, `{}`, string(out))
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMonitor(t, monitor.SiteSpec{URL: testServer.URL, TLS: tt.tls})
+			m.CheckSites(context.Background())
+
+			entry, ok := m.GetEntry(testServer.URL)
+			require.True(t, ok)
+			require.NotNil(t, entry.State)
+			assert.Equal(t, tt.up, entry.State.Up, entry.State.LastError)
+		})
+	}
+}
+
+func TestMonitor_CheckSites_TLS_ClientCertificateFiles(t *testing.T) {
+	root := newTestCA(t, "Test Root CA", nil, 365*24*time.Hour)
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc((&serverStub{}).Handle))
+	testServer.TLS = &tls.Config{
+		Certificates: []tls.Certificate{root.issue(t, 24*time.Hour, "127.0.0.1")},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    root.pool(),
+	}
+	testServer.StartTLS()
+	defer testServer.Close()
+
+	dir := t.TempDir()
+	spec := &monitor.TLSSpec{
+		CAFile:   filepath.Join(dir, "ca.pem"),
+		CertFile: filepath.Join(dir, "tls.crt"),
+		KeyFile:  filepath.Join(dir, "tls.key"),
+	}
+	cert, key := encodePEM(t, root.issue(t, 24*time.Hour, "webmon"))
+	require.NoError(t, os.WriteFile(spec.CAFile, []byte(root.pem()), 0600))
+	require.NoError(t, os.WriteFile(spec.CertFile, []byte(cert), 0600))
+	require.NoError(t, os.WriteFile(spec.KeyFile, []byte(key), 0600))
+
+	m := newMonitor(t, monitor.SiteSpec{URL: testServer.URL, TLS: spec})
+	m.CheckSites(context.Background())
+
+	entry, ok := m.GetEntry(testServer.URL)
+	require.True(t, ok)
+	require.NotNil(t, entry.State)
+	assert.True(t, entry.State.Up, entry.State.LastError)
+
+	require.NoError(t, os.Remove(spec.KeyFile))
+	m.CheckSites(context.Background())
+	entry, _ = m.GetEntry(testServer.URL)
+	assert.False(t, entry.State.Up)
+	assert.Contains(t, entry.State.LastError, "invalid TLS configuration: client key: ")
+}
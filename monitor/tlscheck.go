@@ -0,0 +1,97 @@
+package monitor
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/url"
+	"time"
+)
+
+// checkTLS checks a TLS site (tls://host:port), or a site that upgrades its connection to TLS using STARTTLS
+// (e.g. smtp+starttls://host). The site is up if the TLS handshake succeeds and the connection meets the site's
+// TLS policies. The connection is closed after the handshake. The site's latency is the time it took to set up the
+// connection and complete the handshake.
+func (monitor *Monitor) checkTLS(ctx context.Context, site SiteSpec) (state *SiteState) {
+	state = &SiteState{}
+	target, err := url.Parse(site.URL)
+	if err != nil {
+		state.LastError = err.Error()
+		return
+	}
+
+	tlsConfig, err := monitor.siteTLSConfig(site)
+	if err != nil {
+		state.LastError = "invalid TLS configuration: " + err.Error()
+		return
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = target.Hostname()
+	}
+
+	protocol, startTLS := startTLSProtocols[target.Scheme]
+	address := target.Host
+	if target.Port() == "" {
+		address = net.JoinHostPort(target.Hostname(), protocol.port)
+	}
+
+	start := time.Now()
+	conn, err := dialSite(ctx, site, address)
+	if err != nil {
+		state.setConnectionError(err)
+		return
+	}
+	defer func() { _ = conn.Close() }()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if startTLS {
+		if err = protocol.negotiate(conn); err != nil {
+			state.LastError = "starttls: " + err.Error()
+			return
+		}
+	}
+
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err = tlsConn.HandshakeContext(ctx); err != nil {
+		state.setConnectionError(err)
+		return
+	}
+	state.Latency = Duration{Duration: time.Since(start)}
+	state.Up = true
+
+	connection := tlsConn.ConnectionState()
+	monitor.inspectTLS(ctx, site, &connection, tlsConfig, target.Hostname(), state)
+	_ = tlsConn.Close()
+	return
+}
+
+// inspectTLS records the certificates & negotiated parameters of the site's TLS connection and checks the connection
+// against the site's TLS policies. If the connection violates a policy, the site is reported as down.
+func (monitor *Monitor) inspectTLS(ctx context.Context, site SiteSpec, connection *tls.ConnectionState, tlsConfig *tls.Config, hostname string, state *SiteState) {
+	state.IsTLS = true
+	state.Certificates, state.CertificateAge = inspectChain(connection.PeerCertificates, time.Now())
+	state.setTLSInfo(connection)
+	if err := site.TLS.checkPolicy(connection); err != nil && state.Up {
+		state.Up = false
+		state.LastError = err.Error()
+	}
+	if site.TLS != nil && site.TLS.CheckRevocation {
+		var err error
+		if state.Revocation, state.RevocationSource, err = monitor.checkRevocation(ctx, connection); err != nil {
+			state.RevocationError = err.Error()
+		}
+		if state.Revocation == RevocationRevoked && state.Up {
+			state.Up = false
+			state.LastError = "certificate has been revoked"
+		}
+	}
+	state.TLSVerification = TLSVerificationOK
+	if site.TLS != nil && site.TLS.DeferVerification {
+		var err error
+		if state.TLSVerification, err = verifyChain(connection.PeerCertificates, tlsConfig, hostname, time.Now()); err != nil {
+			state.TLSVerificationError = err.Error()
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package monitor_test
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/clambin/webmon/monitor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMonitor_CheckSites_TLS(t *testing.T) {
+	root := newTestCA(t, "root", nil, 10*365*24*time.Hour)
+	listener := newTLSEndpoint(t, root.issue(t, 30*24*time.Hour, "localhost", "127.0.0.1"), nil)
+	defer func() { _ = listener.Close() }()
+	url := "tls://" + listener.Addr().String()
+
+	testCases := []struct {
+		name         string
+		client       *tls.Config
+		tls          *monitor.TLSSpec
+		up           bool
+		lastError    string
+		verification string
+		isTLS        bool
+	}{
+		{name: "valid", client: &tls.Config{RootCAs: root.pool()}, up: true, verification: monitor.TLSVerificationOK, isTLS: true},
+		{name: "unknown authority", up: false, lastError: "certificate signed by unknown authority", verification: monitor.TLSVerificationUnknownAuthority},
+		{name: "deferred", tls: &monitor.TLSSpec{DeferVerification: true}, up: true, verification: monitor.TLSVerificationUnknownAuthority, isTLS: true},
+		{name: "site ca", tls: &monitor.TLSSpec{CA: root.pem()}, up: true, verification: monitor.TLSVerificationOK, isTLS: true},
+		{name: "policy", client: &tls.Config{RootCAs: root.pool()}, tls: &monitor.TLSSpec{IssuerCN: "R3"}, up: false, lastError: "certificate issuer 'root' does not match 'R3'", verification: monitor.TLSVerificationOK, isTLS: true},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMonitor(t, monitor.SiteSpec{URL: url, TLS: tt.tls})
+			m.HTTPClient = &http.Client{Transport: &http.Transport{TLSClientConfig: tt.client}}
+			m.CheckSites(context.Background())
+
+			entry, ok := m.GetEntry(url)
+			require.True(t, ok)
+			require.NotNil(t, entry.State)
+			assert.Equal(t, tt.up, entry.State.Up)
+			assert.Contains(t, entry.State.LastError, tt.lastError)
+			assert.Equal(t, tt.verification, entry.State.TLSVerification)
+			assert.Equal(t, tt.isTLS, entry.State.IsTLS)
+			if tt.isTLS {
+				require.Len(t, entry.State.Certificates, 1)
+				assert.Equal(t, "CN=localhost", entry.State.Certificates[0].Subject)
+				assert.InDelta(t, 30, entry.State.CertificateAge, 1)
+				assert.NotEmpty(t, entry.State.TLSVersion)
+				assert.NotZero(t, entry.State.Latency.Duration)
+			}
+		})
+	}
+}
+
+func TestMonitor_CheckSites_TLS_NotTLS(t *testing.T) {
+	listener := newTCPServer(t, func(conn net.Conn) {
+		_, _ = conn.Write([]byte("SSH-2.0-OpenSSH_8.9\r\n"))
+	})
+	defer func() { _ = listener.Close() }()
+	url := "tls://" + listener.Addr().String()
+
+	m := newMonitor(t, monitor.SiteSpec{URL: url, Timeout: monitor.Duration{Duration: time.Second}})
+	m.CheckSites(context.Background())
+
+	entry, ok := m.GetEntry(url)
+	require.True(t, ok)
+	require.NotNil(t, entry.State)
+	assert.False(t, entry.State.Up)
+	assert.NotEmpty(t, entry.State.LastError)
+	assert.False(t, entry.State.IsTLS)
+}
+
+// newTLSEndpoint starts a TLS server with the specified certificate. If set, negotiate is called for each connection
+// before the TLS handshake, to emulate a STARTTLS protocol. The server closes the connection after the handshake.
+func newTLSEndpoint(t *testing.T, certificate tls.Certificate, negotiate func(conn net.Conn) error) net.Listener {
+	t.Helper()
+	config := &tls.Config{Certificates: []tls.Certificate{certificate}}
+	return newTCPServer(t, func(conn net.Conn) {
+		if negotiate != nil {
+			if err := negotiate(conn); err != nil {
+				return
+			}
+		}
+		_ = tls.Server(conn, config).Handshake()
+	})
+}
@@ -0,0 +1,147 @@
+package monitor
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// tlsVersions maps the TLS versions supported in TLSSpec.MinVersion to their crypto/tls identifiers
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsVersionName returns the name of a TLS version, e.g. "1.2"
+func tlsVersionName(version uint16) string {
+	for name, id := range tlsVersions {
+		if id == version {
+			return name
+		}
+	}
+	return fmt.Sprintf("0x%04X", version)
+}
+
+// isCipherSuite returns true if name is the name of a cipher suite supported by crypto/tls
+func isCipherSuite(name string) bool {
+	for _, suites := range [][]*tls.CipherSuite{tls.CipherSuites(), tls.InsecureCipherSuites()} {
+		for _, suite := range suites {
+			if suite.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validatePolicy checks that the TLSSpec's policies are valid
+func (spec *TLSSpec) validatePolicy() error {
+	if _, ok := tlsVersions[spec.MinVersion]; spec.MinVersion != "" && ok == false {
+		return fmt.Errorf("tls: invalid minimum version '%s'", spec.MinVersion)
+	}
+	for _, cipher := range spec.ForbiddenCiphers {
+		if isCipherSuite(cipher) == false {
+			return fmt.Errorf("tls: unknown cipher suite '%s'", cipher)
+		}
+	}
+	for _, pin := range spec.Fingerprints {
+		if value, err := hex.DecodeString(normalizeFingerprint(pin)); err != nil || len(value) != sha256.Size {
+			return fmt.Errorf("tls: invalid SHA-256 fingerprint '%s'", pin)
+		}
+	}
+	return nil
+}
+
+// hasVersionPolicy returns true if the TLSSpec restricts the TLS version or cipher suites that the site may negotiate
+func (spec *TLSSpec) hasVersionPolicy() bool {
+	return spec.MinVersion != "" || len(spec.ForbiddenCiphers) > 0
+}
+
+// allowLegacy lets the client negotiate the TLS versions and cipher suites that crypto/tls doesn't offer by default.
+// Otherwise, a site that only supports these fails the handshake, rather than being reported as violating its policy.
+func allowLegacy(config *tls.Config) {
+	config.MinVersion = tls.VersionTLS10
+	config.CipherSuites = nil
+	for _, suites := range [][]*tls.CipherSuite{tls.CipherSuites(), tls.InsecureCipherSuites()} {
+		for _, suite := range suites {
+			config.CipherSuites = append(config.CipherSuites, suite.ID)
+		}
+	}
+}
+
+// normalizeFingerprint removes any colons from a fingerprint and converts it to lowercase
+func normalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+}
+
+// checkPolicy checks the negotiated TLS connection against the site's policies. It returns an error for the
+// first policy that the connection violates.
+func (spec *TLSSpec) checkPolicy(connection *tls.ConnectionState) error {
+	if spec == nil {
+		return nil
+	}
+	if minVersion, ok := tlsVersions[spec.MinVersion]; ok && connection.Version < minVersion {
+		return fmt.Errorf("TLS version %s is lower than the minimum version %s", tlsVersionName(connection.Version), spec.MinVersion)
+	}
+	cipher := tls.CipherSuiteName(connection.CipherSuite)
+	for _, forbidden := range spec.ForbiddenCiphers {
+		if cipher == forbidden {
+			return fmt.Errorf("cipher suite %s is forbidden", cipher)
+		}
+	}
+	if len(connection.PeerCertificates) == 0 {
+		return nil
+	}
+	leaf := connection.PeerCertificates[0]
+	if len(spec.Fingerprints) > 0 {
+		if err := checkFingerprint(fingerprint(leaf), spec.Fingerprints); err != nil {
+			return err
+		}
+	}
+	if spec.IssuerCN != "" && leaf.Issuer.CommonName != spec.IssuerCN {
+		return fmt.Errorf("certificate issuer '%s' does not match '%s'", leaf.Issuer.CommonName, spec.IssuerCN)
+	}
+	return nil
+}
+
+func checkFingerprint(fingerprint string, pins []string) error {
+	for _, pin := range pins {
+		if normalizeFingerprint(pin) == fingerprint {
+			return nil
+		}
+	}
+	return fmt.Errorf("certificate fingerprint %s does not match any pinned fingerprint", fingerprint)
+}
+
+// setTLSInfo records the negotiated TLS parameters and the site certificate's key & signature algorithm
+func (state *SiteState) setTLSInfo(connection *tls.ConnectionState) {
+	state.TLSVersion = tlsVersionName(connection.Version)
+	state.CipherSuite = tls.CipherSuiteName(connection.CipherSuite)
+	if len(connection.PeerCertificates) > 0 {
+		leaf := connection.PeerCertificates[0]
+		state.KeyType, state.KeySize = publicKeyInfo(leaf)
+		state.SignatureAlgorithm = leaf.SignatureAlgorithm.String()
+	}
+}
+
+// publicKeyInfo returns the type and size (in bits) of the certificate's public key
+func publicKeyInfo(certificate *x509.Certificate) (keyType string, size int) {
+	switch key := certificate.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return "RSA", key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return "ECDSA", key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return "Ed25519", 256
+	default:
+		return certificate.PublicKeyAlgorithm.String(), 0
+	}
+}
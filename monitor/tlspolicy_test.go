@@ -0,0 +1,191 @@
+package monitor_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"github.com/clambin/gotools/metrics"
+	"github.com/clambin/webmon/monitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMonitor_CheckSites_TLSPolicy(t *testing.T) {
+	root := newTestCA(t, "Test Root CA", nil, 365*24*time.Hour)
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc((&serverStub{}).Handle))
+	testServer.TLS = &tls.Config{
+		Certificates: []tls.Certificate{root.issue(t, 24*time.Hour, "127.0.0.1")},
+		MaxVersion:   tls.VersionTLS12,
+		CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+	}
+	testServer.StartTLS()
+	defer testServer.Close()
+
+	testCases := []struct {
+		name      string
+		tls       *monitor.TLSSpec
+		up        bool
+		lastError string
+	}{
+		{name: "no policy", up: true},
+		{name: "min version", tls: &monitor.TLSSpec{MinVersion: "1.2"}, up: true},
+		{name: "min version - fail", tls: &monitor.TLSSpec{MinVersion: "1.3"}, up: false, lastError: "TLS version 1.2 is lower than the minimum version 1.3"},
+		{name: "ciphers", tls: &monitor.TLSSpec{ForbiddenCiphers: []string{"TLS_RSA_WITH_AES_128_CBC_SHA"}}, up: true},
+		{name: "ciphers - fail", tls: &monitor.TLSSpec{ForbiddenCiphers: []string{"TLS_RSA_WITH_AES_128_CBC_SHA", "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}}, up: false, lastError: "cipher suite TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 is forbidden"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMonitor(t, monitor.SiteSpec{URL: testServer.URL, TLS: tt.tls})
+			m.HTTPClient = newTLSClient(root)
+			m.CheckSites(context.Background())
+
+			entry, ok := m.GetEntry(testServer.URL)
+			require.True(t, ok)
+			require.NotNil(t, entry.State)
+			assert.Equal(t, tt.up, entry.State.Up)
+			assert.Equal(t, tt.lastError, entry.State.LastError)
+			assert.Equal(t, "1.2", entry.State.TLSVersion)
+			assert.Equal(t, "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", entry.State.CipherSuite)
+			assert.Equal(t, "ECDSA", entry.State.KeyType)
+			assert.Equal(t, 256, entry.State.KeySize)
+			assert.Equal(t, "ECDSA-SHA256", entry.State.SignatureAlgorithm)
+
+			// TLS info is reported, even if the site is down
+			ch := make(chan prometheus.Metric)
+			go func() {
+				m.Collect(ch)
+				close(ch)
+			}()
+			var found bool
+			for metric := range ch {
+				if metrics.MetricName(metric) == "webmon_tls_info" {
+					found = true
+					assert.Equal(t, 1.0, metrics.MetricValue(metric).GetGauge().GetValue())
+					assert.Equal(t, "1.2", metrics.MetricLabel(metric, "version"))
+					assert.Equal(t, "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", metrics.MetricLabel(metric, "cipher_suite"))
+					assert.Equal(t, "ECDSA", metrics.MetricLabel(metric, "key_type"))
+					assert.Equal(t, "256", metrics.MetricLabel(metric, "key_size"))
+					assert.Equal(t, "ECDSA-SHA256", metrics.MetricLabel(metric, "signature_algorithm"))
+				}
+			}
+			assert.True(t, found)
+		})
+	}
+}
+
+func TestMonitor_CheckSites_TLSPolicy_Legacy(t *testing.T) {
+	root := newTestCA(t, "Test Root CA", nil, 365*24*time.Hour)
+	certificate := root.issue(t, 24*time.Hour, "127.0.0.1")
+
+	testCases := []struct {
+		name      string
+		version   uint16
+		cipher    uint16
+		tls       *monitor.TLSSpec
+		up        bool
+		lastError string
+	}{
+		{name: "min version", version: tls.VersionTLS11, cipher: tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA, tls: &monitor.TLSSpec{MinVersion: "1.0"}, up: true},
+		{name: "min version - fail", version: tls.VersionTLS11, cipher: tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA, tls: &monitor.TLSSpec{MinVersion: "1.2"}, lastError: "TLS version 1.1 is lower than the minimum version 1.2"},
+		{name: "min version - 1.0", version: tls.VersionTLS10, cipher: tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA, tls: &monitor.TLSSpec{MinVersion: "1.2"}, lastError: "TLS version 1.0 is lower than the minimum version 1.2"},
+		{name: "insecure cipher", version: tls.VersionTLS12, cipher: tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256, tls: &monitor.TLSSpec{ForbiddenCiphers: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256"}}, lastError: "cipher suite TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256 is forbidden"},
+		{name: "no policy - version", version: tls.VersionTLS11, cipher: tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA, tls: &monitor.TLSSpec{CA: root.pem()}, up: true},
+		{name: "no policy - insecure cipher", version: tls.VersionTLS12, cipher: tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256, tls: &monitor.TLSSpec{CA: root.pem()}, up: true},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			testServer := httptest.NewUnstartedServer(http.HandlerFunc((&serverStub{}).Handle))
+			testServer.TLS = &tls.Config{
+				Certificates: []tls.Certificate{certificate},
+				MinVersion:   tls.VersionTLS10,
+				MaxVersion:   tt.version,
+				CipherSuites: []uint16{tt.cipher},
+			}
+			testServer.StartTLS()
+			defer testServer.Close()
+
+			m := newMonitor(t, monitor.SiteSpec{URL: testServer.URL, TLS: tt.tls})
+			if tt.tls.CA == "" {
+				// a policy offers legacy versions & cipher suites, even if the HTTPClient doesn't.
+				// Without a policy, the monitor's default HTTPClient offers them
+				m.HTTPClient = newTLSClient(root)
+			}
+			m.CheckSites(context.Background())
+
+			entry, ok := m.GetEntry(testServer.URL)
+			require.True(t, ok)
+			require.NotNil(t, entry.State)
+			assert.Equal(t, tt.up, entry.State.Up)
+			assert.Equal(t, tt.lastError, entry.State.LastError)
+
+			// the negotiated version & cipher suite are reported, rather than the handshake failing
+			ch := make(chan prometheus.Metric)
+			go func() {
+				m.Collect(ch)
+				close(ch)
+			}()
+			var found bool
+			for metric := range ch {
+				if metrics.MetricName(metric) == "webmon_tls_info" {
+					found = true
+					assert.Equal(t, entry.State.TLSVersion, metrics.MetricLabel(metric, "version"))
+					assert.Equal(t, tls.CipherSuiteName(tt.cipher), metrics.MetricLabel(metric, "cipher_suite"))
+				}
+			}
+			assert.True(t, found)
+		})
+	}
+}
+
+func TestMonitor_CheckSites_TLSPinning(t *testing.T) {
+	root := newTestCA(t, "Test Root CA", nil, 365*24*time.Hour)
+	certificate := root.issue(t, 24*time.Hour, "127.0.0.1")
+	testServer := newTLSServer(t, certificate)
+	defer testServer.Close()
+
+	sum := sha256.Sum256(certificate.Leaf.Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+	var colons []string
+	for _, b := range sum {
+		colons = append(colons, fmt.Sprintf("%02X", b))
+	}
+	other := strings.Repeat("0", 64)
+
+	testCases := []struct {
+		name      string
+		tls       *monitor.TLSSpec
+		up        bool
+		lastError string
+	}{
+		{name: "fingerprint", tls: &monitor.TLSSpec{Fingerprints: []string{fingerprint}}, up: true},
+		{name: "fingerprint - colons", tls: &monitor.TLSSpec{Fingerprints: []string{other, strings.Join(colons, ":")}}, up: true},
+		{name: "fingerprint - fail", tls: &monitor.TLSSpec{Fingerprints: []string{other}}, up: false, lastError: "certificate fingerprint " + fingerprint + " does not match any pinned fingerprint"},
+		{name: "issuer", tls: &monitor.TLSSpec{IssuerCN: "Test Root CA"}, up: true},
+		{name: "issuer - fail", tls: &monitor.TLSSpec{IssuerCN: "Other CA"}, up: false, lastError: "certificate issuer 'Test Root CA' does not match 'Other CA'"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMonitor(t, monitor.SiteSpec{URL: testServer.URL, TLS: tt.tls})
+			m.HTTPClient = newTLSClient(root)
+			m.CheckSites(context.Background())
+
+			entry, ok := m.GetEntry(testServer.URL)
+			require.True(t, ok)
+			require.NotNil(t, entry.State)
+			assert.Equal(t, tt.up, entry.State.Up)
+			assert.Equal(t, tt.lastError, entry.State.LastError)
+			assert.Equal(t, fingerprint, entry.State.Fingerprint)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package monitor
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings contains the duration of each phase of a site's check
+type Timings struct {
+	// DNS is the time it took to resolve the site's hostname. Zero if the URL contains an IP address
+	DNS Duration `json:"dns"`
+	// Connect is the time it took to set up the TCP connection
+	Connect Duration `json:"connect"`
+	// TLS is the time it took to perform the TLS handshake. Zero for HTTP sites
+	TLS Duration `json:"tls"`
+	// TTFB (time to first byte) is the time between sending the request and receiving the first byte of the response
+	TTFB Duration `json:"ttfb"`
+	// Transfer is the time it took to read the response body
+	Transfer Duration `json:"transfer"`
+}
+
+// tracer records the timestamps of each phase of an HTTP request, using net/http/httptrace
+type tracer struct {
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	reused       bool
+	lock         sync.Mutex
+}
+
+func (t *tracer) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(_ httptrace.DNSStartInfo) { t.record(&t.dnsStart) },
+		DNSDone:  func(_ httptrace.DNSDoneInfo) { t.record(&t.dnsDone) },
+		// the dialer may try several addresses in parallel: measure from the first attempt to the established connection
+		ConnectStart: func(_, _ string) {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				t.record(&t.connectDone)
+			}
+		},
+		TLSHandshakeStart: func() { t.record(&t.tlsStart) },
+		TLSHandshakeDone:  func(_ tls.ConnectionState, _ error) { t.record(&t.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+			t.reused = info.Reused
+		},
+		WroteRequest:         func(_ httptrace.WroteRequestInfo) { t.record(&t.wroteRequest) },
+		GotFirstResponseByte: func() { t.record(&t.firstByte) },
+	}
+}
+
+func (t *tracer) record(timestamp *time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	*timestamp = time.Now()
+}
+
+// timings returns the duration of each phase. done is the time when the response body was read.
+func (t *tracer) timings(done time.Time) (timings *Timings, reused bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return &Timings{
+		DNS:      phase(t.dnsStart, t.dnsDone),
+		Connect:  phase(t.connectStart, t.connectDone),
+		TLS:      phase(t.tlsStart, t.tlsDone),
+		TTFB:     phase(t.wroteRequest, t.firstByte),
+		Transfer: phase(t.firstByte, done),
+	}, t.reused
+}
+
+func phase(start, end time.Time) Duration {
+	if start.IsZero() || end.Before(start) {
+		return Duration{}
+	}
+	return Duration{Duration: end.Sub(start)}
+}
@@ -0,0 +1,164 @@
+package monitor
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"golang.org/x/net/websocket"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// webSocketPorts contains the default port of each WebSocket scheme
+var webSocketPorts = map[string]string{"ws": "80", "wss": "443"}
+
+// A WebSocketSpec specifies how a WebSocket site (ws:// or wss://) is checked. The site is up if the WebSocket
+// handshake succeeds and, if specified, the site replies to Send with a message that matches Expect.
+type WebSocketSpec struct {
+	// Send is sent as a text message once the handshake completes
+	Send string `json:"send,omitempty"`
+	// Expect is a regular expression that one of the site's messages must match. If Send is set, the messages
+	// received in reply to Send are checked
+	Expect string `json:"expect,omitempty"`
+}
+
+func (spec *WebSocketSpec) validate() error {
+	if _, err := regexp.Compile(spec.Expect); err != nil {
+		return fmt.Errorf("websocket: invalid regular expression \"%s\": %w", spec.Expect, err)
+	}
+	return nil
+}
+
+// checkWebSocket checks a WebSocket site. The site's latency is the time it took to complete the WebSocket handshake.
+// If the site's WebSocketSpec specifies a message exchange, the time between sending the message and receiving the
+// expected reply is reported in RoundTrip.
+func (monitor *Monitor) checkWebSocket(ctx context.Context, site SiteSpec) (state *SiteState) {
+	state = &SiteState{}
+	config, err := monitor.webSocketConfig(site)
+	if err != nil {
+		state.LastError = err.Error()
+		return
+	}
+
+	address := config.Location.Host
+	if config.Location.Port() == "" {
+		address = net.JoinHostPort(config.Location.Hostname(), webSocketPorts[config.Location.Scheme])
+	}
+	if host := config.Header.Get("Host"); host != "" {
+		config.Location.Host = host
+		config.Header.Del("Host")
+	}
+
+	start := time.Now()
+	conn, err := dialSite(ctx, site, address)
+	if err != nil {
+		state.setConnectionError(err)
+		return
+	}
+	defer func() { _ = conn.Close() }()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	var connection *tls.ConnectionState
+	if config.TlsConfig != nil {
+		tlsConn := tls.Client(conn, config.TlsConfig)
+		if err = tlsConn.HandshakeContext(ctx); err != nil {
+			state.setConnectionError(err)
+			return
+		}
+		conn = tlsConn
+		tlsState := tlsConn.ConnectionState()
+		connection = &tlsState
+	}
+
+	ws, err := websocket.NewClient(config, conn)
+	if err != nil {
+		state.LastError = "websocket handshake: " + err.Error()
+		return
+	}
+	state.Latency = Duration{Duration: time.Since(start)}
+	state.Up = true
+	ws.MaxPayloadBytes = DefaultMaxContentSize
+
+	if site.WebSocket != nil && (site.WebSocket.Send != "" || site.WebSocket.Expect != "") {
+		var roundTrip time.Duration
+		if roundTrip, err = exchangeMessages(ws, site.WebSocket); err != nil {
+			state.Up = false
+			state.LastError = err.Error()
+		} else {
+			state.RoundTrip = &Duration{Duration: roundTrip}
+		}
+	}
+
+	if connection != nil {
+		monitor.inspectTLS(ctx, site, connection, config.TlsConfig, config.Location.Hostname(), state)
+	}
+	_ = ws.Close()
+	return
+}
+
+// webSocketConfig returns the configuration of the WebSocket handshake: the site's headers and, for wss sites, the
+// TLS configuration
+func (monitor *Monitor) webSocketConfig(site SiteSpec) (config *websocket.Config, err error) {
+	target, err := url.Parse(site.URL)
+	if err != nil {
+		return nil, err
+	}
+	origin := &url.URL{Scheme: "http", Host: target.Host}
+	if target.Scheme == "wss" {
+		origin.Scheme = "https"
+	}
+	config = &websocket.Config{Location: target, Origin: origin, Version: websocket.ProtocolVersionHybi13, Header: http.Header{}}
+
+	for _, header := range site.Headers {
+		var value string
+		if value, err = header.value(); err != nil {
+			return nil, err
+		}
+		config.Header.Add(header.Name, value)
+	}
+
+	if target.Scheme == "wss" {
+		if config.TlsConfig, err = monitor.siteTLSConfig(site); err != nil {
+			return nil, fmt.Errorf("invalid TLS configuration: %w", err)
+		}
+		if config.TlsConfig.ServerName == "" {
+			config.TlsConfig.ServerName = target.Hostname()
+		}
+		config.TlsConfig.NextProtos = []string{"http/1.1"}
+	}
+	return config, nil
+}
+
+// exchangeMessages sends the WebSocketSpec's Send message and waits for a message that matches Expect. It returns the
+// time between sending the message and receiving the matching reply.
+func exchangeMessages(ws *websocket.Conn, spec *WebSocketSpec) (roundTrip time.Duration, err error) {
+	expect, err := regexp.Compile(spec.Expect)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	if spec.Send != "" {
+		if err = websocket.Message.Send(ws, spec.Send); err != nil {
+			return 0, fmt.Errorf("send: %w", err)
+		}
+	}
+	var message string
+	for {
+		var received string
+		if err = websocket.Message.Receive(ws, &received); err != nil {
+			if message == "" {
+				return 0, fmt.Errorf("receive: %w", err)
+			}
+			return 0, fmt.Errorf("reply %q does not match \"%s\"", message, spec.Expect)
+		}
+		message = received
+		if expect.MatchString(message) {
+			return time.Since(start), nil
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package monitor_test
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/clambin/gotools/metrics"
+	"github.com/clambin/webmon/monitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMonitor_CheckSites_WebSocket(t *testing.T) {
+	testServer := httptest.NewServer(websocket.Handler(upperCaseEcho))
+	defer testServer.Close()
+	url := "ws" + strings.TrimPrefix(testServer.URL, "http")
+
+	plainServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer plainServer.Close()
+	plainURL := "ws" + strings.TrimPrefix(plainServer.URL, "http")
+
+	testCases := []struct {
+		name      string
+		url       string
+		websocket *monitor.WebSocketSpec
+		up        bool
+		lastError string
+		roundTrip bool
+	}{
+		{name: "handshake", url: url, up: true},
+		{name: "greeting", url: url, websocket: &monitor.WebSocketSpec{Expect: "^HELLO$"}, up: true, roundTrip: true},
+		{name: "echo", url: url, websocket: &monitor.WebSocketSpec{Send: "ping", Expect: "^PING$"}, up: true, roundTrip: true},
+		{name: "echo - fail", url: url, websocket: &monitor.WebSocketSpec{Send: "ping", Expect: "^PONG$"}, lastError: `reply "PING" does not match "^PONG$"`},
+		{name: "not a websocket", url: plainURL, lastError: "websocket handshake: bad status"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMonitor(t, monitor.SiteSpec{URL: tt.url, WebSocket: tt.websocket, Timeout: monitor.Duration{Duration: 200 * time.Millisecond}})
+			m.CheckSites(context.Background())
+
+			entry, ok := m.GetEntry(tt.url)
+			require.True(t, ok)
+			require.NotNil(t, entry.State)
+			assert.Equal(t, tt.up, entry.State.Up)
+			assert.Equal(t, tt.lastError, entry.State.LastError)
+			assert.Equal(t, tt.roundTrip, entry.State.RoundTrip != nil)
+			assert.False(t, entry.State.IsTLS)
+			if tt.up {
+				assert.NotZero(t, entry.State.Latency.Duration)
+			}
+		})
+	}
+}
+
+func TestMonitor_CheckSites_WebSocket_TLS(t *testing.T) {
+	root := newTestCA(t, "root", nil, 10*365*24*time.Hour)
+	testServer := httptest.NewUnstartedServer(websocket.Handler(upperCaseEcho))
+	testServer.TLS = &tls.Config{Certificates: []tls.Certificate{root.issue(t, 30*24*time.Hour, "localhost", "127.0.0.1")}}
+	testServer.StartTLS()
+	defer testServer.Close()
+	url := "wss" + strings.TrimPrefix(testServer.URL, "https")
+
+	testCases := []struct {
+		name         string
+		tls          *monitor.TLSSpec
+		up           bool
+		lastError    string
+		verification string
+	}{
+		{name: "valid", tls: &monitor.TLSSpec{CA: root.pem()}, up: true, verification: monitor.TLSVerificationOK},
+		{name: "unknown authority", lastError: "x509: certificate signed by unknown authority", verification: monitor.TLSVerificationUnknownAuthority},
+		{name: "deferred", tls: &monitor.TLSSpec{DeferVerification: true}, up: true, verification: monitor.TLSVerificationUnknownAuthority},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMonitor(t, monitor.SiteSpec{URL: url, TLS: tt.tls, WebSocket: &monitor.WebSocketSpec{Send: "ping", Expect: "PING"}})
+			m.CheckSites(context.Background())
+
+			entry, ok := m.GetEntry(url)
+			require.True(t, ok)
+			require.NotNil(t, entry.State)
+			assert.Equal(t, tt.up, entry.State.Up)
+			assert.Contains(t, entry.State.LastError, tt.lastError)
+			assert.Equal(t, tt.verification, entry.State.TLSVerification)
+			assert.Equal(t, tt.up, entry.State.IsTLS)
+			if tt.up {
+				require.Len(t, entry.State.Certificates, 1)
+				assert.Equal(t, "CN=localhost", entry.State.Certificates[0].Subject)
+				require.NotNil(t, entry.State.RoundTrip)
+				assert.NotZero(t, entry.State.RoundTrip.Duration)
+			}
+		})
+	}
+}
+
+func TestCollector_Collect_WebSocket(t *testing.T) {
+	testServer := httptest.NewServer(websocket.Handler(upperCaseEcho))
+	defer testServer.Close()
+	url := "ws" + strings.TrimPrefix(testServer.URL, "http")
+
+	m := newMonitor(t, monitor.SiteSpec{URL: url, WebSocket: &monitor.WebSocketSpec{Send: "ping", Expect: "PING"}})
+	m.CheckSites(context.Background())
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		m.Collect(ch)
+		close(ch)
+	}()
+
+	var found bool
+	for metric := range ch {
+		if metrics.MetricName(metric) == "webmon_site_round_trip_seconds" {
+			found = true
+			assert.NotZero(t, metrics.MetricValue(metric).GetGauge().GetValue())
+			assert.Equal(t, url, metrics.MetricLabel(metric, "site_url"))
+		}
+	}
+	assert.True(t, found)
+}
+
+// upperCaseEcho greets each client with HELLO and replies to each message with the message in uppercase
+func upperCaseEcho(ws *websocket.Conn) {
+	if websocket.Message.Send(ws, "HELLO") != nil {
+		return
+	}
+	for {
+		var message string
+		if websocket.Message.Receive(ws, &message) != nil {
+			return
+		}
+		if websocket.Message.Send(ws, strings.ToUpper(message)) != nil {
+			return
+		}
+	}
+}
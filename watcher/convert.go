@@ -0,0 +1,207 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	v1 "github.com/clambin/webmon/crds/targets/api/types/v1"
+	"github.com/clambin/webmon/monitor"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"path/filepath"
+	"strings"
+)
+
+// toSiteSpec converts a Target's spec to a SiteSpec. Any values referring to a Secret are resolved.
+func (watcher *Watcher) toSiteSpec(ctx context.Context, namespace string, spec v1.TargetSpec) (site monitor.SiteSpec, err error) {
+	site = monitor.SiteSpec{
+		URL:              spec.URL,
+		Name:             spec.Name,
+		Interval:         toDuration(spec.Interval),
+		Timeout:          toDuration(spec.Timeout),
+		Method:           spec.Method,
+		Body:             spec.Body,
+		StatusCodes:      spec.StatusCodes,
+		Content:          toContentSpec(spec.Content),
+		JSON:             toJSONAssertions(spec.JSON),
+		DNS:              toDNSSpec(spec.DNS),
+		GRPC:             toGRPCSpec(spec.GRPC),
+		TCP:              toTCPSpec(spec.TCP),
+		WebSocket:        toWebSocketSpec(spec.WebSocket),
+		ResolveTo:        spec.ResolveTo,
+		AllAddresses:     spec.AllAddresses,
+		Quorum:           spec.Quorum,
+		IPFamily:         spec.IPFamily,
+		Retries:          spec.Retries,
+		RetryBackoff:     toDuration(spec.RetryBackoff),
+		FailureThreshold: spec.FailureThreshold,
+		SuccessThreshold: spec.SuccessThreshold,
+	}
+	if site.Headers, err = watcher.toHeaders(ctx, namespace, spec.Headers); err == nil {
+		site.TLS, err = watcher.toTLSSpec(ctx, namespace, spec.TLS)
+	}
+	if err == nil {
+		site.Proxy, err = watcher.toProxySpec(ctx, namespace, spec.Proxy)
+	}
+	return
+}
+
+func (watcher *Watcher) toHeaders(ctx context.Context, namespace string, headers []v1.Header) (result []monitor.Header, err error) {
+	for _, header := range headers {
+		entry := monitor.Header{Name: header.Name, Value: header.Value}
+		if entry.ValueFile, entry.SecretValue, err = watcher.resolve(ctx, namespace, header.ValueFrom); err != nil {
+			return nil, fmt.Errorf("header %s: %w", header.Name, err)
+		}
+		result = append(result, entry)
+	}
+	return
+}
+
+func (watcher *Watcher) toTLSSpec(ctx context.Context, namespace string, spec *v1.TLSSpec) (result *monitor.TLSSpec, err error) {
+	if spec == nil {
+		return nil, nil
+	}
+	result = &monitor.TLSSpec{
+		DeferVerification: spec.DeferVerification,
+		MinVersion:        spec.MinVersion,
+		ForbiddenCiphers:  spec.ForbiddenCiphers,
+		Fingerprints:      spec.Fingerprints,
+		IssuerCN:          spec.IssuerCN,
+		CheckRevocation:   spec.CheckRevocation,
+	}
+	if result.CAFile, result.CA, err = watcher.resolve(ctx, namespace, spec.CA); err != nil {
+		return nil, fmt.Errorf("tls ca: %w", err)
+	}
+	if result.CertFile, result.Cert, err = watcher.resolve(ctx, namespace, spec.Certificate); err != nil {
+		return nil, fmt.Errorf("tls certificate: %w", err)
+	}
+	if result.KeyFile, result.Key, err = watcher.resolve(ctx, namespace, spec.Key); err != nil {
+		return nil, fmt.Errorf("tls key: %w", err)
+	}
+	return
+}
+
+func (watcher *Watcher) toProxySpec(ctx context.Context, namespace string, spec *v1.ProxySpec) (result *monitor.ProxySpec, err error) {
+	if spec == nil {
+		return nil, nil
+	}
+	result = &monitor.ProxySpec{URL: spec.URL, Direct: spec.Direct, Username: spec.Username}
+	if result.PasswordFile, result.SecretPassword, err = watcher.resolve(ctx, namespace, spec.Password); err != nil {
+		return nil, fmt.Errorf("proxy password: %w", err)
+	}
+	return
+}
+
+// resolve returns the file name, or the value read from the Secret, that the ValueSource refers to
+func (watcher *Watcher) resolve(ctx context.Context, namespace string, source *v1.ValueSource) (file, value string, err error) {
+	if source == nil {
+		return
+	}
+	if source.File != "" {
+		if file, err = watcher.getFile(source.File); err != nil {
+			return
+		}
+	}
+	if source.SecretKeyRef != nil {
+		value, err = watcher.getSecret(ctx, namespace, *source.SecretKeyRef)
+	}
+	return
+}
+
+// getFile returns the full name of the file. Relative names are relative to the watcher's FileDirectory. Files outside
+// the FileDirectory are refused, so a Target can't read webmon's own credentials (e.g. its service account token).
+func (watcher *Watcher) getFile(name string) (string, error) {
+	if watcher.FileDirectory == "" {
+		return "", errors.New("watcher does not allow reading files")
+	}
+	directory, err := filepath.Abs(watcher.FileDirectory)
+	if err != nil {
+		return "", err
+	}
+	file := name
+	if filepath.IsAbs(file) == false {
+		file = filepath.Join(directory, file)
+	}
+	file = filepath.Clean(file)
+	if relative, err := filepath.Rel(directory, file); err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("file '%s' is outside %s", name, directory)
+	}
+	return file, nil
+}
+
+func (watcher *Watcher) getSecret(ctx context.Context, namespace string, ref v1.SecretKeySelector) (string, error) {
+	if watcher.Secrets == nil {
+		return "", errors.New("watcher has no access to secrets")
+	}
+	secret, err := watcher.Secrets.Secrets(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	value, ok := secret.Data[ref.Key]
+	if ok == false {
+		return "", fmt.Errorf("secret %s/%s has no key '%s'", namespace, ref.Name, ref.Key)
+	}
+	return string(value), nil
+}
+
+func toDuration(duration *metav1.Duration) monitor.Duration {
+	if duration == nil {
+		return monitor.Duration{}
+	}
+	return monitor.Duration{Duration: duration.Duration}
+}
+
+func toContentSpec(spec *v1.ContentSpec) *monitor.ContentSpec {
+	if spec == nil {
+		return nil
+	}
+	return &monitor.ContentSpec{
+		Contains:    spec.Contains,
+		NotContains: spec.NotContains,
+		Matches:     spec.Matches,
+		MaxSize:     spec.MaxSize,
+	}
+}
+
+func toJSONAssertions(assertions []v1.JSONAssertion) (result []monitor.JSONAssertion) {
+	for _, assertion := range assertions {
+		result = append(result, monitor.JSONAssertion{
+			Path:     assertion.Path,
+			Operator: assertion.Operator,
+			Value:    assertion.Value,
+		})
+	}
+	return
+}
+
+func toDNSSpec(spec *v1.DNSSpec) *monitor.DNSSpec {
+	if spec == nil {
+		return nil
+	}
+	return &monitor.DNSSpec{
+		Addresses: spec.Addresses,
+		CNAME:     spec.CNAME,
+		MinTTL:    toDuration(spec.MinTTL),
+		NXDomain:  spec.NXDomain,
+	}
+}
+
+func toGRPCSpec(spec *v1.GRPCSpec) *monitor.GRPCSpec {
+	if spec == nil {
+		return nil
+	}
+	return &monitor.GRPCSpec{Service: spec.Service}
+}
+
+func toTCPSpec(spec *v1.TCPSpec) *monitor.TCPSpec {
+	if spec == nil {
+		return nil
+	}
+	return &monitor.TCPSpec{Send: spec.Send, Expect: spec.Expect}
+}
+
+func toWebSocketSpec(spec *v1.WebSocketSpec) *monitor.WebSocketSpec {
+	if spec == nil {
+		return nil
+	}
+	return &monitor.WebSocketSpec{Send: spec.Send, Expect: spec.Expect}
+}
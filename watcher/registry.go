@@ -45,3 +45,11 @@ func (r *registry) delete(namespace, name string) (spec v1.TargetSpec) {
 
 	return
 }
+
+func (r *registry) each(f func(namespace, name string, spec v1.TargetSpec)) {
+	for namespace, names := range r.namespaces {
+		for name, spec := range names {
+			f(namespace, name, spec)
+		}
+	}
+}
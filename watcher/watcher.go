@@ -2,35 +2,54 @@ package watcher
 
 import (
 	"context"
+	"errors"
 	v1 "github.com/clambin/webmon/crds/targets/api/types/v1"
 	clientV1 "github.com/clambin/webmon/crds/targets/clientset/v1"
 	"github.com/clambin/webmon/monitor"
 	log "github.com/sirupsen/logrus"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/watch"
+	coreV1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"reflect"
 	"time"
 )
 
+// SiteManager adds, updates and removes the sites to be monitored. Implemented by monitor.Monitor.
+type SiteManager interface {
+	AddSite(site monitor.SiteSpec) error
+	UpdateSite(site monitor.SiteSpec) error
+	RemoveSite(url string) error
+}
+
+// DefaultResyncInterval specifies how often a Watcher re-reads the Secrets referred to by its Targets
+const DefaultResyncInterval = 5 * time.Minute
+
 // A Watcher checks kubernetes custom resources ("Target") on a periodic basis for new URLs to monitor
 type Watcher struct {
-	Client     clientV1.TargetsCRDInterface
-	register   chan monitor.SiteSpec
-	unregister chan monitor.SiteSpec
-	namespace  string
-	store      *registry
+	Client clientV1.TargetsCRDInterface
+	// Secrets gives access to the Secrets referred to by a Target. If nil, Targets referring to a Secret are not monitored.
+	Secrets coreV1.SecretsGetter
+	// ResyncInterval specifies how often all Targets are registered again, so rotated Secrets are picked up.
+	// Default: DefaultResyncInterval
+	ResyncInterval time.Duration
+	// FileDirectory is the directory that Targets may read files from. Files outside this directory are refused.
+	// If blank, Targets referring to a file are not monitored.
+	FileDirectory string
+	sites         SiteManager
+	namespace     string
+	store         *registry
 }
 
-// NewWithClient creates a Watcher for the specified API client. When Watcher finds a created/removed URL, it sends
-// the URL to the register/unregister channel respectively.
+// NewWithClient creates a Watcher for the specified API client. When Watcher finds a created/modified/removed URL,
+// it adds/updates/removes the site in the SiteManager respectively.
 // If the namespace is specified, Watcher will only scan that namespace. Otherwise, all namespaces are scanned.
 // Note that this needs RBAC setup to ensure the client can access those resources.
-func NewWithClient(register, unregister chan monitor.SiteSpec, namespace string, client clientV1.TargetsCRDInterface) *Watcher {
+func NewWithClient(sites SiteManager, namespace string, client clientV1.TargetsCRDInterface) *Watcher {
 	return &Watcher{
-		Client:     client,
-		register:   register,
-		unregister: unregister,
-		namespace:  namespace,
-		store:      newRegistry(),
+		Client:    client,
+		sites:     sites,
+		namespace: namespace,
+		store:     newRegistry(),
 	}
 }
 
@@ -43,21 +62,30 @@ func (watcher *Watcher) Run(ctx context.Context) {
 	// k8s may stop sending events after 30 minutes, so we renew it periodically
 	ticker := time.NewTicker(25 * time.Minute)
 
+	resyncInterval := watcher.ResyncInterval
+	if resyncInterval <= 0 {
+		resyncInterval = DefaultResyncInterval
+	}
+	resync := time.NewTicker(resyncInterval)
+
 	for running := true; running; {
 		select {
 		case <-ctx.Done():
 			running = false
 		case event := <-w.ResultChan():
-			watcher.processEvent(event)
+			watcher.processEvent(ctx, event)
 		case <-ticker.C:
 			w.Stop()
 			w = watcher.watch(ctx)
 			log.Debug("renewed custom resource watcher")
+		case <-resync.C:
+			watcher.resync(ctx)
 		}
 	}
 
 	w.Stop()
 	ticker.Stop()
+	resync.Stop()
 
 	log.Info("watcher stopped")
 }
@@ -73,7 +101,7 @@ func (watcher *Watcher) watch(ctx context.Context) (w watch.Interface) {
 	return
 }
 
-func (watcher *Watcher) processEvent(event watch.Event) {
+func (watcher *Watcher) processEvent(ctx context.Context, event watch.Event) {
 	if event.Object == nil {
 		log.WithField("type", event.Type).Warning("ignoring CRD event without an object")
 		return
@@ -90,22 +118,52 @@ func (watcher *Watcher) processEvent(event watch.Event) {
 	switch event.Type {
 	case watch.Added:
 		watcher.store.add(target.Namespace, target.Name, target.Spec)
-		watcher.register <- monitor.SiteSpec{
-			URL:  target.Spec.URL,
-			Name: target.Spec.Name,
-		}
+		watcher.registerTarget(ctx, target, "")
 	case watch.Deleted:
 		spec := watcher.store.delete(target.Namespace, target.Name)
-		watcher.unregister <- monitor.SiteSpec{URL: spec.URL}
+		watcher.unregisterURL(spec.URL)
 	case watch.Modified:
 		spec, ok := watcher.store.get(target.Namespace, target.Name)
-		if ok && spec != target.Spec {
+		if ok && reflect.DeepEqual(spec, target.Spec) == false {
 			watcher.store.add(target.Namespace, target.Name, target.Spec)
-			watcher.unregister <- monitor.SiteSpec{URL: spec.URL}
-			watcher.register <- monitor.SiteSpec{
-				URL:  target.Spec.URL,
-				Name: target.Spec.Name,
-			}
+			watcher.registerTarget(ctx, target, spec.URL)
 		}
 	}
 }
+
+// registerTarget adds or updates the site for the Target. If the Target's URL changed, the site for the old URL is removed.
+func (watcher *Watcher) registerTarget(ctx context.Context, target *v1.Target, oldURL string) {
+	if oldURL != "" && oldURL != target.Spec.URL {
+		watcher.unregisterURL(oldURL)
+	}
+
+	site, err := watcher.toSiteSpec(ctx, target.Namespace, target.Spec)
+	if err == nil {
+		err = watcher.sites.AddSite(site)
+		if errors.Is(err, monitor.ErrDuplicateSite) {
+			err = watcher.sites.UpdateSite(site)
+		}
+	}
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"name":      target.Name,
+			"namespace": target.Namespace,
+		}).Error("unable to register target")
+	}
+}
+
+// resync registers all Targets again. Any Secrets referred to by a Target are read again: if they changed,
+// the site is updated.
+func (watcher *Watcher) resync(ctx context.Context) {
+	log.Debug("resyncing targets")
+	watcher.store.each(func(namespace, name string, spec v1.TargetSpec) {
+		target := &v1.Target{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}, Spec: spec}
+		watcher.registerTarget(ctx, target, "")
+	})
+}
+
+func (watcher *Watcher) unregisterURL(url string) {
+	if err := watcher.sites.RemoveSite(url); err != nil {
+		log.WithError(err).Warning("unable to unregister target")
+	}
+}
@@ -7,17 +7,20 @@ import (
 	"github.com/clambin/webmon/monitor"
 	"github.com/clambin/webmon/watcher"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coreV1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"reflect"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestWatcher_Run(t *testing.T) {
 	client := mock.New()
-
-	register := make(chan monitor.SiteSpec)
-	unregister := make(chan monitor.SiteSpec)
-
-	w := watcher.NewWithClient(register, unregister, "", client)
+	m := monitor.New([]string{"https://example.net"})
+	w := watcher.NewWithClient(m, "", client)
 
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -29,20 +32,264 @@ func TestWatcher_Run(t *testing.T) {
 	}()
 
 	client.Add("foo", "bar", v1.TargetSpec{URL: "https://example.com"})
-	site := <-register
-	assert.Equal(t, "https://example.com", site.URL)
+	waitForSites(t, m, []monitor.SiteSpec{{URL: "https://example.com"}, {URL: "https://example.net"}})
 
 	client.Modify("foo", "bar", v1.TargetSpec{URL: "https://example.com:443"})
-	site = <-unregister
-	assert.Equal(t, "https://example.com", site.URL)
-	site = <-register
-	assert.Equal(t, "https://example.com:443", site.URL)
+	waitForSites(t, m, []monitor.SiteSpec{{URL: "https://example.com:443"}, {URL: "https://example.net"}})
+
+	client.Modify("foo", "bar", v1.TargetSpec{URL: "https://example.com:443", StatusCodes: "200-299"})
+	waitForSites(t, m, []monitor.SiteSpec{{URL: "https://example.com:443", StatusCodes: "200-299"}, {URL: "https://example.net"}})
+
+	client.Modify("foo", "bar", v1.TargetSpec{URL: "https://example.com:443", Content: &v1.ContentSpec{NotContains: []string{"Maintenance mode"}, MaxSize: 1024}})
+	waitForSites(t, m, []monitor.SiteSpec{
+		{URL: "https://example.com:443", Content: &monitor.ContentSpec{NotContains: []string{"Maintenance mode"}, MaxSize: 1024}},
+		{URL: "https://example.net"},
+	})
+
+	client.Modify("foo", "bar", v1.TargetSpec{URL: "https://example.com:443", JSON: []v1.JSONAssertion{{Path: "status", Value: "ok"}}})
+	waitForSites(t, m, []monitor.SiteSpec{
+		{URL: "https://example.com:443", JSON: []monitor.JSONAssertion{{Path: "status", Value: "ok"}}},
+		{URL: "https://example.net"},
+	})
+
+	client.Modify("foo", "bar", v1.TargetSpec{URL: "https://example.com:443", TLS: &v1.TLSSpec{DeferVerification: true, MinVersion: "1.2", ForbiddenCiphers: []string{"TLS_RSA_WITH_AES_128_CBC_SHA"}, IssuerCN: "R3", CheckRevocation: true}})
+	waitForSites(t, m, []monitor.SiteSpec{
+		{URL: "https://example.com:443", TLS: &monitor.TLSSpec{DeferVerification: true, MinVersion: "1.2", ForbiddenCiphers: []string{"TLS_RSA_WITH_AES_128_CBC_SHA"}, IssuerCN: "R3", CheckRevocation: true}},
+		{URL: "https://example.net"},
+	})
+
+	client.Modify("foo", "bar", v1.TargetSpec{URL: "dns://8.8.8.8/example.com", DNS: &v1.DNSSpec{Addresses: []string{"192.0.2.1"}, MinTTL: &metav1.Duration{Duration: time.Minute}}})
+	waitForSites(t, m, []monitor.SiteSpec{
+		{URL: "dns://8.8.8.8/example.com", DNS: &monitor.DNSSpec{Addresses: []string{"192.0.2.1"}, MinTTL: monitor.Duration{Duration: time.Minute}}},
+		{URL: "https://example.net"},
+	})
+
+	client.Modify("foo", "bar", v1.TargetSpec{URL: "grpcs://example.com:443", GRPC: &v1.GRPCSpec{Service: "foo.Bar"}, TLS: &v1.TLSSpec{MinVersion: "1.3"}})
+	waitForSites(t, m, []monitor.SiteSpec{
+		{URL: "grpcs://example.com:443", GRPC: &monitor.GRPCSpec{Service: "foo.Bar"}, TLS: &monitor.TLSSpec{MinVersion: "1.3"}},
+		{URL: "https://example.net"},
+	})
+
+	client.Modify("foo", "bar", v1.TargetSpec{URL: "tcp://example.com:25", TCP: &v1.TCPSpec{Send: "EHLO webmon\r\n", Expect: "^220 "}})
+	waitForSites(t, m, []monitor.SiteSpec{
+		{URL: "https://example.net"},
+		{URL: "tcp://example.com:25", TCP: &monitor.TCPSpec{Send: "EHLO webmon\r\n", Expect: "^220 "}},
+	})
+
+	client.Modify("foo", "bar", v1.TargetSpec{URL: "wss://example.com/ws", WebSocket: &v1.WebSocketSpec{Send: "ping", Expect: "pong"}})
+	waitForSites(t, m, []monitor.SiteSpec{
+		{URL: "https://example.net"},
+		{URL: "wss://example.com/ws", WebSocket: &monitor.WebSocketSpec{Send: "ping", Expect: "pong"}},
+	})
+
+	client.Modify("foo", "bar", v1.TargetSpec{URL: "https://example.com:443", AllAddresses: true, Quorum: 2, IPFamily: "both"})
+	waitForSites(t, m, []monitor.SiteSpec{
+		{URL: "https://example.com:443", AllAddresses: true, Quorum: 2, IPFamily: monitor.IPFamilyBoth},
+		{URL: "https://example.net"},
+	})
+
+	client.Modify("foo", "bar", v1.TargetSpec{URL: "https://example.com:443", ResolveTo: "192.0.2.10"})
+	waitForSites(t, m, []monitor.SiteSpec{
+		{URL: "https://example.com:443", ResolveTo: "192.0.2.10"},
+		{URL: "https://example.net"},
+	})
+
+	client.Modify("foo", "bar", v1.TargetSpec{URL: "https://example.com:443", Retries: 2, RetryBackoff: &metav1.Duration{Duration: time.Second}, FailureThreshold: 3})
+	waitForSites(t, m, []monitor.SiteSpec{
+		{URL: "https://example.com:443", Retries: 2, RetryBackoff: monitor.Duration{Duration: time.Second}, FailureThreshold: 3},
+		{URL: "https://example.net"},
+	})
+
+	// a target for a site that is already monitored updates the site
+	client.Add("foo", "snafu", v1.TargetSpec{URL: "https://example.net", Name: "net"})
+	waitForSites(t, m, []monitor.SiteSpec{
+		{URL: "https://example.com:443", Retries: 2, RetryBackoff: monitor.Duration{Duration: time.Second}, FailureThreshold: 3},
+		{URL: "https://example.net", Name: "net"},
+	})
+
+	// invalid targets are not monitored
+	client.Add("foo", "invalid", v1.TargetSpec{URL: "ftp://example.org"})
 
 	client.Delete("foo", "bar")
-	site = <-unregister
-	assert.Equal(t, "https://example.com:443", site.URL)
+	waitForSites(t, m, []monitor.SiteSpec{{URL: "https://example.net", Name: "net"}})
+
+	cancel()
+
+	wg.Wait()
+}
+
+func TestWatcher_Secrets(t *testing.T) {
+	client := mock.New()
+	m := monitor.New(nil)
+	w := watcher.NewWithClient(m, "", client)
+	w.Secrets = fake.NewSimpleClientset(&coreV1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "foo"},
+		Data:       map[string][]byte{"key": []byte("secret")},
+	}).CoreV1()
+	w.FileDirectory = "/etc/webmon"
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		w.Run(ctx)
+		wg.Done()
+	}()
+
+	client.Add("foo", "bar", v1.TargetSpec{
+		URL:      "https://example.com",
+		Interval: &metav1.Duration{Duration: 5 * time.Minute},
+		Method:   "POST",
+		Body:     "ping",
+		Headers: []v1.Header{
+			{Name: "Accept", Value: "application/json"},
+			{Name: "X-API-Key", ValueFrom: &v1.ValueSource{SecretKeyRef: &v1.SecretKeySelector{Name: "api", Key: "key"}}},
+			{Name: "X-Token", ValueFrom: &v1.ValueSource{File: "token"}},
+		},
+		Proxy: &v1.ProxySpec{
+			URL:      "http://proxy.example.com:3128",
+			Username: "webmon",
+			Password: &v1.ValueSource{SecretKeyRef: &v1.SecretKeySelector{Name: "api", Key: "key"}},
+		},
+	})
+
+	// targets referring to a missing secret are not registered
+	client.Add("foo", "snafu", v1.TargetSpec{
+		URL:     "https://example.org",
+		Headers: []v1.Header{{Name: "X-API-Key", ValueFrom: &v1.ValueSource{SecretKeyRef: &v1.SecretKeySelector{Name: "api", Key: "missing"}}}},
+	})
+	client.Add("foo", "snafu2", v1.TargetSpec{URL: "https://example.net"})
+	// targets referring to a file outside the watcher's FileDirectory are not registered
+	client.Add("foo", "token", v1.TargetSpec{
+		URL:     "https://example.edu",
+		Headers: []v1.Header{{Name: "X-Token", ValueFrom: &v1.ValueSource{File: "/var/run/secrets/kubernetes.io/serviceaccount/token"}}},
+	})
+	client.Add("foo", "token2", v1.TargetSpec{
+		URL:     "https://example.io",
+		Headers: []v1.Header{{Name: "X-Token", ValueFrom: &v1.ValueSource{File: "../../var/run/secrets/kubernetes.io/serviceaccount/token"}}},
+	})
+
+	waitForSites(t, m, []monitor.SiteSpec{{
+		URL:      "https://example.com",
+		Interval: monitor.Duration{Duration: 5 * time.Minute},
+		Method:   "POST",
+		Body:     "ping",
+		Headers: []monitor.Header{
+			{Name: "Accept", Value: "application/json"},
+			{Name: "X-API-Key", SecretValue: "secret"},
+			{Name: "X-Token", ValueFile: "/etc/webmon/token"},
+		},
+		Proxy: &monitor.ProxySpec{URL: "http://proxy.example.com:3128", Username: "webmon", SecretPassword: "secret"},
+	}, {
+		URL: "https://example.net",
+	}})
+
+	cancel()
+
+	wg.Wait()
+}
+
+func TestWatcher_Files(t *testing.T) {
+	client := mock.New()
+	m := monitor.New(nil)
+	w := watcher.NewWithClient(m, "", client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		w.Run(ctx)
+		wg.Done()
+	}()
+
+	// without a FileDirectory, targets referring to a file are not registered
+	client.Add("foo", "bar", v1.TargetSpec{
+		URL:     "https://example.com",
+		Headers: []v1.Header{{Name: "X-Token", ValueFrom: &v1.ValueSource{File: "token"}}},
+	})
+	client.Add("foo", "tls", v1.TargetSpec{
+		URL: "https://example.org",
+		TLS: &v1.TLSSpec{Key: &v1.ValueSource{File: "/var/run/secrets/kubernetes.io/serviceaccount/token"}},
+	})
+	client.Add("foo", "proxy", v1.TargetSpec{
+		URL:   "https://example.io",
+		Proxy: &v1.ProxySpec{URL: "http://proxy.example.com:3128", Username: "webmon", Password: &v1.ValueSource{File: "password"}},
+	})
+	client.Add("foo", "snafu", v1.TargetSpec{URL: "https://example.net"})
+
+	waitForSites(t, m, []monitor.SiteSpec{{URL: "https://example.net"}})
 
 	cancel()
 
 	wg.Wait()
 }
+
+func TestWatcher_Resync(t *testing.T) {
+	client := mock.New()
+	m := monitor.New(nil)
+	w := watcher.NewWithClient(m, "", client)
+	w.ResyncInterval = 10 * time.Millisecond
+	secrets := fake.NewSimpleClientset(&coreV1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "tls", Namespace: "foo"},
+		Data:       map[string][]byte{"ca.crt": []byte("ca"), "tls.crt": []byte("cert"), "tls.key": []byte("key")},
+	})
+	w.Secrets = secrets.CoreV1()
+	w.FileDirectory = "/etc/webmon"
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		w.Run(ctx)
+		wg.Done()
+	}()
+
+	client.Add("foo", "bar", v1.TargetSpec{
+		URL: "https://example.com",
+		TLS: &v1.TLSSpec{
+			CA:          &v1.ValueSource{SecretKeyRef: &v1.SecretKeySelector{Name: "tls", Key: "ca.crt"}},
+			Certificate: &v1.ValueSource{SecretKeyRef: &v1.SecretKeySelector{Name: "tls", Key: "tls.crt"}},
+			Key:         &v1.ValueSource{File: "/etc/webmon/tls.key"},
+		},
+	})
+	// targets referring to a missing secret are registered once the secret is created
+	client.Add("foo", "snafu", v1.TargetSpec{
+		URL: "https://example.org",
+		TLS: &v1.TLSSpec{CA: &v1.ValueSource{SecretKeyRef: &v1.SecretKeySelector{Name: "ca", Key: "ca.crt"}}},
+	})
+
+	waitForSites(t, m, []monitor.SiteSpec{
+		{URL: "https://example.com", TLS: &monitor.TLSSpec{CA: "ca", Cert: "cert", KeyFile: "/etc/webmon/tls.key"}},
+	})
+
+	// rotated secrets are picked up
+	_, err := secrets.CoreV1().Secrets("foo").Update(ctx, &coreV1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "tls", Namespace: "foo"},
+		Data:       map[string][]byte{"ca.crt": []byte("new ca"), "tls.crt": []byte("new cert")},
+	}, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	_, err = secrets.CoreV1().Secrets("foo").Create(ctx, &coreV1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "ca", Namespace: "foo"},
+		Data:       map[string][]byte{"ca.crt": []byte("ca")},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	waitForSites(t, m, []monitor.SiteSpec{
+		{URL: "https://example.com", TLS: &monitor.TLSSpec{CA: "new ca", Cert: "new cert", KeyFile: "/etc/webmon/tls.key"}},
+		{URL: "https://example.org", TLS: &monitor.TLSSpec{CA: "ca"}},
+	})
+
+	cancel()
+
+	wg.Wait()
+}
+
+func waitForSites(t *testing.T, m *monitor.Monitor, expected []monitor.SiteSpec) {
+	t.Helper()
+	if assert.Eventually(t, func() bool { return reflect.DeepEqual(expected, m.Sites()) }, time.Second, 10*time.Millisecond) == false {
+		assert.Equal(t, expected, m.Sites())
+	}
+}
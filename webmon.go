@@ -11,6 +11,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/alecthomas/kingpin.v2"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"net/http"
@@ -28,6 +29,7 @@ var (
 	interval       time.Duration
 	watch          bool
 	watchNamespace string
+	watchFiles     string
 	kubeconfig     string
 )
 
@@ -39,9 +41,10 @@ func main() {
 	a.VersionFlag.Short('v')
 	a.Flag("port", "Metrics listener port").Default("8080").IntVar(&port)
 	a.Flag("debug", "Log debug messages").BoolVar(&debug)
-	a.Flag("interval", "Measurement interval").Default("1m").DurationVar(&interval)
+	a.Flag("interval", "Default measurement interval").Default("1m").DurationVar(&interval)
 	a.Flag("watch", "Watch k8s CRDs for target hosts").BoolVar(&watch)
 	a.Flag("watch.namespace", "Namespace to watch for CRDs (default: all namespaces)").Default("").StringVar(&watchNamespace)
+	a.Flag("watch.files", "Directory that Targets may read files from (default: none)").Default("").StringVar(&watchFiles)
 	a.Flag("watch.kubeconfig", "~/.kube/config").StringVar(&kubeconfig)
 	hosts := a.Arg("hosts", "hosts to ping").Strings()
 
@@ -82,7 +85,9 @@ func main() {
 
 	// Register hosts
 	for _, host := range *hosts {
-		myMonitor.Register <- monitor.SiteSpec{URL: host}
+		if err = myMonitor.AddSite(monitor.SiteSpec{URL: host}); err != nil {
+			log.WithError(err).Fatal("invalid host")
+		}
 	}
 
 	if watch {
@@ -138,9 +143,17 @@ func newWatcher(monitor *monitor.Monitor, namespace string) (w *watcher.Watcher,
 		client, err = clientV1.NewForConfig(config)
 	}
 
+	var secrets *kubernetes.Clientset
+	if err == nil {
+		secrets, err = kubernetes.NewForConfig(config)
+	}
+
 	if err != nil {
 		return
 	}
 
-	return watcher.NewWithClient(monitor.Register, monitor.Unregister, namespace, client), nil
+	w = watcher.NewWithClient(monitor, namespace, client)
+	w.Secrets = secrets.CoreV1()
+	w.FileDirectory = watchFiles
+	return
 }